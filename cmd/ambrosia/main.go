@@ -125,6 +125,60 @@ func main() {
 						Usage:   "if --rougel is set, the threshold for comparison",
 						Value:   0.7,
 					},
+					&cli.StringFlag{
+						Name:    "keep",
+						EnvVars: []string{"AMBROSIA_KEEP", "KEEP"},
+						Usage:   "which near-duplicate to keep: 'first', 'last', 'longest' or 'shortest'; only 'first' is supported with --minhash or exact dedupe",
+						Value:   "first",
+					},
+					&cli.StringFlag{
+						Name:      "clusters",
+						EnvVars:   []string{"AMBROSIA_CLUSTERS", "CLUSTERS"},
+						Usage:     "if --rougel is set, write a JSONL report of each group of near-duplicates to `PATH`",
+						TakesFile: true,
+					},
+					&cli.StringSliceFlag{
+						Name:      "against",
+						EnvVars:   []string{"AMBROSIA_AGAINST", "AGAINST"},
+						Usage:     "also remove data that duplicates any entry in the comma-separated reference `FILE`(s)",
+						TakesFile: true,
+					},
+					&cli.StringSliceFlag{
+						Name:    "against-fields",
+						EnvVars: []string{"AMBROSIA_AGAINST_FIELDS", "AGAINST_FIELDS"},
+						Usage:   "the `FIELD`(s) in the --against files to compare, in the same order as --fields, if they differ",
+					},
+					&cli.BoolFlag{
+						Name:    "minhash",
+						Aliases: []string{"mh"},
+						EnvVars: []string{"AMBROSIA_MINHASH", "MINHASH"},
+						Usage:   "use MinHash and LSH to find near-duplicates, if --rougel is also set candidates are confirmed with ROUGE-L",
+						Value:   false,
+					},
+					&cli.IntFlag{
+						Name:        "mh-shingle",
+						EnvVars:     []string{"AMBROSIA_MH_SHINGLE", "MH_SHINGLE"},
+						Usage:       "if --minhash is set, the number of words in each shingle",
+						DefaultText: "3",
+					},
+					&cli.IntFlag{
+						Name:        "mh-perms",
+						EnvVars:     []string{"AMBROSIA_MH_PERMS", "MH_PERMS"},
+						Usage:       "if --minhash is set, the number of permutations in each signature",
+						DefaultText: "128",
+					},
+					&cli.IntFlag{
+						Name:        "mh-bands",
+						EnvVars:     []string{"AMBROSIA_MH_BANDS", "MH_BANDS"},
+						Usage:       "if --minhash is set, the number of LSH bands, must divide --mh-perms",
+						DefaultText: "16",
+					},
+					&cli.Float64Flag{
+						Name:        "mh-threshold",
+						EnvVars:     []string{"AMBROSIA_MH_THRESHOLD", "MH_THRESHOLD"},
+						Usage:       "if --minhash is set, the estimated Jaccard similarity at or above which data are duplicates",
+						DefaultText: "0.7",
+					},
 					&cli.BoolFlag{
 						Name:    "progress",
 						Aliases: []string{"p"},
@@ -132,6 +186,12 @@ func main() {
 						Usage:   "show progress bar",
 						Value:   false,
 					},
+					&cli.StringFlag{
+						Name:      "rejects",
+						EnvVars:   []string{"AMBROSIA_REJECTS", "REJECTS"},
+						Usage:     "write dropped data, with its line number and the reason it was dropped, to `PATH`",
+						TakesFile: true,
+					},
 				},
 			},
 			{
@@ -160,6 +220,60 @@ func main() {
 						Usage:       "the maximum length of a field (>=)",
 						DefaultText: "nil",
 					},
+					&cli.StringFlag{
+						Name:    "unit",
+						Aliases: []string{"u"},
+						EnvVars: []string{"AMBROSIA_UNIT", "UNIT"},
+						Usage:   "the `UNIT` to measure length in: bytes, runes, words or tokens",
+						Value:   "bytes",
+					},
+					&cli.StringFlag{
+						Name:      "tokenizer",
+						EnvVars:   []string{"AMBROSIA_TOKENIZER", "TOKENIZER"},
+						Usage:     "a tiktoken ranks or HuggingFace tokenizer.json `FILE`, for --unit tokens",
+						TakesFile: true,
+					},
+					&cli.StringFlag{
+						Name:      "rejects",
+						EnvVars:   []string{"AMBROSIA_REJECTS", "REJECTS"},
+						Usage:     "write dropped data, with its line number and the reason it was dropped, to `PATH`",
+						TakesFile: true,
+					},
+				},
+			},
+			{
+				Name:      "stats",
+				ArgsUsage: "INFILE.jsonl",
+				Usage:     "print length statistics and histograms, to help choose length bounds",
+				Action:    internal.CmdInit,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "fields",
+						Aliases:  []string{"f"},
+						EnvVars:  []string{"AMBROSIA_FIELDS", "FIELDS"},
+						Usage:    "the comma-separated json `FIELD`(s) to measure, multiple fields are also summed",
+						Required: true,
+						Category: "required:",
+					},
+					&cli.StringFlag{
+						Name:    "unit",
+						Aliases: []string{"u"},
+						EnvVars: []string{"AMBROSIA_UNIT", "UNIT"},
+						Usage:   "the `UNIT` to measure length in: bytes, runes, words or tokens",
+						Value:   "bytes",
+					},
+					&cli.StringFlag{
+						Name:      "tokenizer",
+						EnvVars:   []string{"AMBROSIA_TOKENIZER", "TOKENIZER"},
+						Usage:     "a tiktoken ranks or HuggingFace tokenizer.json `FILE`, for --unit tokens",
+						TakesFile: true,
+					},
+					&cli.IntFlag{
+						Name:    "bins",
+						EnvVars: []string{"AMBROSIA_BINS", "BINS"},
+						Usage:   "the maximum number of histogram `BINS`",
+						Value:   10,
+					},
 				},
 			},
 			{
@@ -199,6 +313,83 @@ func main() {
 						Usage:    "a string to filter on",
 						Category: "type:",
 					},
+					&cli.StringFlag{
+						Name:      "rejects",
+						EnvVars:   []string{"AMBROSIA_REJECTS", "REJECTS"},
+						Usage:     "write dropped data, with its line number and the reason it was dropped, to `PATH`",
+						TakesFile: true,
+					},
+				},
+			},
+			{
+				Name:      "decontam",
+				ArgsUsage: "INFILE.jsonl [OUTFILE.jsonl]",
+				Usage:     "remove data that shares an n-gram with benchmark data",
+				Action:    internal.CmdInit,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "fields",
+						Aliases:  []string{"f"},
+						EnvVars:  []string{"AMBROSIA_FIELDS", "FIELDS"},
+						Usage:    "the comma-separated json `FIELD`(s) in each piece of data to compare",
+						Required: true,
+						Category: "required:",
+					},
+					&cli.StringSliceFlag{
+						Name:      "benchmarks",
+						Aliases:   []string{"b"},
+						EnvVars:   []string{"AMBROSIA_BENCHMARKS", "BENCHMARKS"},
+						Usage:     "the comma-separated benchmark JSONL `FILE`(s) to check against",
+						TakesFile: true,
+						Required:  true,
+						Category:  "required:",
+					},
+					&cli.StringSliceFlag{
+						Name:    "benchmark-fields",
+						EnvVars: []string{"AMBROSIA_BENCHMARK_FIELDS", "BENCHMARK_FIELDS"},
+						Usage:   "the `FIELD`(s) in the benchmark files to compare, in the same order as --fields, if they differ",
+					},
+					&cli.IntFlag{
+						Name:        "ngram",
+						Aliases:     []string{"n"},
+						EnvVars:     []string{"AMBROSIA_NGRAM", "NGRAM"},
+						Usage:       "the number of words in an n-gram, data sharing any n-gram with a benchmark is removed",
+						DefaultText: "13",
+					},
+					&cli.StringFlag{
+						Name:      "rejects",
+						EnvVars:   []string{"AMBROSIA_REJECTS", "REJECTS"},
+						Usage:     "write dropped data, with its line number and the reason it was dropped, to `PATH`",
+						TakesFile: true,
+					},
+				},
+			},
+			{
+				Name:      "pipeline",
+				ArgsUsage: "INFILE.jsonl [OUTFILE.jsonl]",
+				Usage:     "run whitespace, length, filter and dedupe stages in a single pass",
+				Action:    internal.CmdInit,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:      "recipe",
+						Aliases:   []string{"r"},
+						EnvVars:   []string{"AMBROSIA_RECIPE", "RECIPE"},
+						Usage:     "a YAML or JSON `FILE` listing the stages to run and their options",
+						TakesFile: true,
+						Category:  "stages:",
+					},
+					&cli.GenericFlag{
+						Name:     "stage",
+						Usage:    "a `STAGE` to run, e.g. 'length fields=output min=10', may be repeated and stages run in order",
+						Value:    &internal.StageFlag{},
+						Category: "stages:",
+					},
+					&cli.StringFlag{
+						Name:      "rejects",
+						EnvVars:   []string{"AMBROSIA_REJECTS", "REJECTS"},
+						Usage:     "write dropped data, with its line number and the reason it was dropped, to `PATH`",
+						TakesFile: true,
+					},
 				},
 			},
 			{
@@ -211,9 +402,20 @@ func main() {
 						Name:    "model",
 						Aliases: []string{"m"},
 						EnvVars: []string{"AMBROSIA_MODEL", "MODEL"},
-						Usage:   "the `MODEL` to use, supported: ['gpt-3.5-turbo', 'gpt-4']",
+						Usage:   "the `MODEL` to use, optionally as PROVIDER:MODEL, e.g. 'gpt-4', 'claude-3-5-haiku-latest' or 'ollama:llama3'",
 						Value:   "gpt-3.5-turbo",
 					},
+					&cli.StringFlag{
+						Name:    "provider",
+						EnvVars: []string{"AMBROSIA_PROVIDER", "PROVIDER"},
+						Usage:   "the `PROVIDER` serving the model: openai, messages, ollama, llamacpp or one from --models, picked from the model name if not set",
+					},
+					&cli.StringFlag{
+						Name:      "models",
+						EnvVars:   []string{"AMBROSIA_MODELS", "MODELS"},
+						Usage:     "a YAML or JSON `FILE` adding providers and per-model defaults",
+						TakesFile: true,
+					},
 					&cli.StringFlag{
 						Name:    "token",
 						Aliases: []string{"t"},
@@ -253,12 +455,114 @@ func main() {
 						EnvVars: []string{"AMBROSIA_FIELDS", "FIELDS"},
 						Usage:   "the json `FIELD`(s) to use for prompts.  All fields used in random order if not specified.",
 					},
+					&cli.StringFlag{
+						Name:      "template",
+						EnvVars:   []string{"AMBROSIA_TEMPLATE", "TEMPLATE"},
+						Usage:     "a Go text/template `FILE` to build each prompt from, instead of --instruction, --fields and --end-instruction",
+						TakesFile: true,
+					},
+					&cli.StringFlag{
+						Name:      "examples",
+						EnvVars:   []string{"AMBROSIA_EXAMPLES", "EXAMPLES"},
+						Usage:     "a JSONL `FILE` of labeled examples, sent before each prompt as earlier user and assistant messages",
+						TakesFile: true,
+					},
+					&cli.StringFlag{
+						Name:    "example-label-field",
+						EnvVars: []string{"AMBROSIA_EXAMPLE_LABEL_FIELD", "EXAMPLE_LABEL_FIELD"},
+						Usage:   "the `FIELD` in --examples holding the response the model should give",
+						Value:   "label",
+					},
+					&cli.StringFlag{
+						Name:      "sysprompt-template",
+						EnvVars:   []string{"AMBROSIA_SYSPROMPT_TEMPLATE", "SYSPROMPT_TEMPLATE"},
+						Usage:     "a Go text/template `FILE` to build each system prompt from, instead of --sysprompt",
+						TakesFile: true,
+					},
 					&cli.BoolFlag{
 						Name:    "json",
 						Aliases: []string{"j"},
 						EnvVars: []string{"AMBROSIA_JSON", "JSON"},
 						Usage:   "send data portion of prompt as a json object, instead of a string with fields",
 					},
+					&cli.StringSliceFlag{
+						Name:    "labels",
+						EnvVars: []string{"AMBROSIA_LABELS", "LABELS"},
+						Usage:   "the comma-separated `LABEL`(s) a response must be, ignoring case and surrounding punctuation, instead of sorting by its first character",
+					},
+					&cli.StringFlag{
+						Name:    "label-regex",
+						EnvVars: []string{"AMBROSIA_LABEL_REGEX", "LABEL_REGEX"},
+						Usage:   "sort by the first capture group, or the whole match, of `REGEX` in the response",
+					},
+					&cli.BoolFlag{
+						Name:    "json-schema",
+						EnvVars: []string{"AMBROSIA_JSON_SCHEMA", "JSON_SCHEMA"},
+						Usage:   "parse the response as a json object and sort by the value of --label-key",
+					},
+					&cli.StringFlag{
+						Name:    "label-key",
+						EnvVars: []string{"AMBROSIA_LABEL_KEY", "LABEL_KEY"},
+						Usage:   "if --json-schema is set, the `KEY` to sort by",
+						Value:   "label",
+					},
+					&cli.BoolFlag{
+						Name:    "score",
+						EnvVars: []string{"AMBROSIA_SCORE", "SCORE"},
+						Usage:   "parse a number from the response, store it in --score-field and report the distribution, instead of sorting by label",
+					},
+					&cli.StringFlag{
+						Name:    "score-field",
+						EnvVars: []string{"AMBROSIA_SCORE_FIELD", "SCORE_FIELD"},
+						Usage:   "if --score is set, the `FIELD` to store the score in",
+						Value:   "score",
+					},
+					&cli.Float64SliceFlag{
+						Name:    "threshold",
+						EnvVars: []string{"AMBROSIA_THRESHOLD", "THRESHOLD"},
+						Usage:   "if --score is set, the comma-separated `THRESHOLD`(s) to split output files at, instead of a single file",
+					},
+					&cli.IntFlag{
+						Name:        "votes",
+						EnvVars:     []string{"AMBROSIA_VOTES", "VOTES"},
+						Usage:       "send each prompt `N` times and take the majority label, or the mean --score",
+						DefaultText: "1",
+					},
+					&cli.Float64Flag{
+						Name:        "min-agreement",
+						EnvVars:     []string{"AMBROSIA_MIN_AGREEMENT", "MIN_AGREEMENT"},
+						Usage:       "if --votes is set, the share of votes that must agree, otherwise data is written to the review file",
+						DefaultText: "more than half",
+					},
+					&cli.StringFlag{
+						Name:    "agreement-field",
+						EnvVars: []string{"AMBROSIA_AGREEMENT_FIELD", "AGREEMENT_FIELD"},
+						Usage:   "if --votes is set, the `FIELD` to store the share of votes that agreed in",
+						Value:   "agreement",
+					},
+					&cli.Float64Flag{
+						Name:        "temperature",
+						EnvVars:     []string{"AMBROSIA_TEMPERATURE", "TEMPERATURE"},
+						Usage:       "the sampling temperature, above 0 so --votes can differ",
+						DefaultText: "the model's default",
+					},
+					&cli.Float64Flag{
+						Name:        "top-p",
+						EnvVars:     []string{"AMBROSIA_TOP_P", "TOP_P"},
+						Usage:       "the nucleus sampling probability mass, on models that support it",
+						DefaultText: "the model's default",
+					},
+					&cli.StringSliceFlag{
+						Name:    "stop",
+						EnvVars: []string{"AMBROSIA_STOP", "STOP"},
+						Usage:   "the comma-separated `SEQUENCE`(s) that end the response, escapes such as '\\n' are allowed",
+					},
+					&cli.IntFlag{
+						Name:        "seed",
+						EnvVars:     []string{"AMBROSIA_SEED", "SEED"},
+						Usage:       "the sampling `SEED`, on models that support it, each vote uses the next seed",
+						DefaultText: "random",
+					},
 					&cli.BoolFlag{
 						Name:    "include-resp",
 						Aliases: []string{"ir"},
@@ -306,6 +610,18 @@ func main() {
 						Usage:   "the maximum amount of time to wait for a response from the model before retrying",
 						Value:   15 * time.Second,
 					},
+					&cli.IntFlag{
+						Name:    "max-retries",
+						EnvVars: []string{"AMBROSIA_MAX_RETRIES", "MAX_RETRIES"},
+						Usage:   "the maximum number of times to retry a request that failed with a rate limit, server error or timeout, -1 for unlimited",
+						Value:   5,
+					},
+					&cli.Float64Flag{
+						Name:        "budget",
+						EnvVars:     []string{"AMBROSIA_BUDGET", "BUDGET"},
+						Usage:       "stop sending requests once they've cost `AMOUNT`, at the model's prices from --models",
+						DefaultText: "no limit",
+					},
 					&cli.BoolFlag{
 						Name:    "progress",
 						Aliases: []string{"p"},
@@ -315,6 +631,12 @@ func main() {
 					},
 				},
 			},
+			{
+				Name:      "lineage",
+				ArgsUsage: "FILE.jsonl",
+				Usage:     "print how a file was made, following the manifests of its inputs back to the source",
+				Action:    internal.CmdLineage,
+			},
 		},
 	}
 
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// refDatum is a datum from a reference file, with its fields renamed to match
+// the input's fields.
+type refDatum struct {
+	// path is the reference file, as given.
+	path   string
+	source string
+	d      datum
+}
+
+// readAgainst calls fn for every datum in the --against reference files.  If
+// --against-fields is set, those fields are renamed to the matching --fields
+// so that references format the same way as the input.
+func readAgainst(o options, fn func(ref refDatum) error) error {
+	return readRefs(o, "against", "against-fields", fn)
+}
+
+// readRefs calls fn for every datum in the files listed in the filesOpt
+// option, renaming the fields listed in fieldsOpt to the matching --fields.
+func readRefs(o options, filesOpt, fieldsOpt string, fn func(ref refDatum) error) error {
+	fields := o.StringSlice("fields")
+	refFields := fields
+	if o.IsSet(fieldsOpt) {
+		refFields = o.StringSlice(fieldsOpt)
+		if len(refFields) != len(fields) {
+			return fmt.Errorf("--%s has %d fields, but --fields has %d", fieldsOpt, len(refFields), len(fields))
+		}
+	}
+
+	for _, path := range o.StringSlice(filesOpt) {
+		if err := readRefFile(path, fields, refFields, fn); err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+func readRefFile(path string, fields, refFields []string, fn func(ref refDatum) error) error {
+	r, err := newDatumReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	name := filepath.Base(path)
+	for {
+		d, line, err := r.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		mapped := make(datum)
+		for i, f := range refFields {
+			if v, ok := d[f]; ok {
+				mapped[fields[i]] = v
+			}
+		}
+
+		err = fn(refDatum{
+			path:   path,
+			source: fmt.Sprintf("%s:%d", name, line),
+			d:      mapped,
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// rougeLAgainst compares every token list against every reference, in
+// parallel.  It returns a drop reason for each token list that has a ROUGE-L
+// score above --rl-threshold with any reference.
+func rougeLAgainst(c *cmdCtx, tokens [][]string) ([]string, error) {
+	fields := c.c.StringSlice("fields")
+
+	type ref struct {
+		source string
+		tokens []string
+	}
+
+	var refs []ref
+	err := readAgainst(c.c, func(r refDatum) error {
+		rt := strings.Fields(strings.ToLower(r.d.String(fields, true)))
+		if len(rt) > 0 {
+			refs = append(refs, ref{source: r.source, tokens: rt})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Info().Int("reference_count", len(refs)).Msg("loaded reference data")
+
+	thresh := c.c.Float64("rl-threshold")
+	reasons := make([]string, len(tokens))
+
+	var next int64 = -1
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(tokens) {
+					return
+				}
+				if len(tokens[i]) == 0 {
+					continue
+				}
+
+				for _, r := range refs {
+					rl := rougeL(tokens[i], r.tokens)
+					if rl > thresh {
+						reasons[i] = fmt.Sprintf("duplicate_of: %s, rougel: %.2f", r.source, rl)
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return reasons, nil
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"flag"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func mustDedupeStage(t *testing.T, c *cmdCtx) *dedupeStage {
+	s, err := newDedupeStage(c, c.c)
+	require.NoError(t, err)
+	return s
+}
+
+func TestDedupeAgainst(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	refDir := t.TempDir()
+	evalPath := filepath.Join(refDir, "eval.jsonl")
+	require.NoError(t, write(evalPath, []datum{
+		{"question": "what is the capital of france"},
+		{"question": "how many legs does a spider have"},
+	}))
+	otherPath := filepath.Join(refDir, "other.jsonl")
+	require.NoError(t, write(otherPath, []datum{
+		{"question": "name a primary colour"},
+	}))
+
+	data := []datum{
+		{"instruction": "what is the capital of france"},
+		{"instruction": "write a short poem about the sea"},
+		{"instruction": "name a primary colour"},
+		{"instruction": "how many legs does a spider have?"},
+	}
+
+	newCtx := func(args ...string) *cmdCtx {
+		set := flag.NewFlagSet("test", 0)
+		set.Var(cli.NewStringSlice("instruction"), "fields", "doc")
+		set.Var(cli.NewStringSlice(), "against", "doc")
+		set.Var(cli.NewStringSlice(), "against-fields", "doc")
+		set.Float64("rl-threshold", 0.8, "doc")
+		require.NoError(t, set.Parse(args))
+		return &cmdCtx{c: cli.NewContext(cli.NewApp(), set, nil), logger: zerolog.Nop()}
+	}
+
+	t.Run("exact", func(t *testing.T) {
+		c := newCtx("--against", evalPath+","+otherPath, "--against-fields", "question")
+		s := mustDedupeStage(t, c)
+
+		var reasons []string
+		for i, d := range data {
+			reason, err := s.apply(i+1, d)
+			assert.NoError(t, err)
+			reasons = append(reasons, reason)
+		}
+		assert.Equal(t, []string{"duplicate_of: eval.jsonl:1", "", "duplicate_of: other.jsonl:1", ""}, reasons)
+	})
+
+	t.Run("exact without field mapping", func(t *testing.T) {
+		c := newCtx("--against", evalPath)
+		s := mustDedupeStage(t, c)
+
+		reason, err := s.apply(1, data[0])
+		assert.NoError(t, err)
+		assert.Empty(t, reason)
+	})
+
+	t.Run("mismatched field mapping", func(t *testing.T) {
+		c := newCtx("--against", evalPath, "--against-fields", "question,answer")
+		_, err := newDedupeStage(c, c.c)
+		assert.Error(t, err)
+	})
+
+	t.Run("missing reference file", func(t *testing.T) {
+		c := newCtx("--against", filepath.Join(refDir, "missing.jsonl"))
+		_, err := newDedupeStage(c, c.c)
+		assert.Error(t, err)
+	})
+
+	t.Run("rougel", func(t *testing.T) {
+		c := newCtx("--against", evalPath+","+otherPath, "--against-fields", "question")
+
+		res, err := dedupeRL(c, data)
+		assert.NoError(t, err)
+		assert.Equal(t, []datum{data[1]}, res.deduped)
+		assert.Len(t, res.rejected, 3)
+		assert.Equal(t, 4, res.rejected[2].Line)
+		assert.Contains(t, res.rejected[2].Reason, "duplicate_of: eval.jsonl:2")
+		assert.Empty(t, res.clusters)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"unicode"
 )
@@ -14,47 +15,41 @@ var (
 	errNilResponse = fmt.Errorf("nil response")
 )
 
+// prefixAppender appends data to a file per label, named by filling in
+// pathTmpl with the label.
 type prefixAppender struct {
-	appenders map[rune]*fileAppender
+	appenders map[string]*fileAppender
 	mutex     *sync.Mutex
 	pathTmpl  string
 }
 
 func newPrefixAppender(pathTmpl string) *prefixAppender {
 	return &prefixAppender{
-		appenders: make(map[rune]*fileAppender),
+		appenders: make(map[string]*fileAppender),
 		mutex:     &sync.Mutex{},
 		pathTmpl:  pathTmpl,
 	}
 }
 
-func (a *prefixAppender) append(resp string, d datum) error {
-	if len(resp) == 0 {
+func (a *prefixAppender) append(label string, d datum) error {
+	if len(label) == 0 {
 		return errNilResponse
 	}
 
-	var prefix rune
-	for _, char := range resp {
-		if !unicode.IsSpace(char) && !unicode.IsPunct(char) {
-			prefix = char
-			break
-		}
-	}
-
 	var appender *fileAppender
 	var ok bool
 
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
-	appender, ok = a.appenders[prefix]
+	appender, ok = a.appenders[label]
 	if !ok {
-		path := fmt.Sprintf(a.pathTmpl, prefix)
+		path := fmt.Sprintf(a.pathTmpl, fileSafe(label))
 		newA, err := newFileAppender(path)
 		if err != nil {
 			return err
 		}
-		a.appenders[prefix] = newA
+		a.appenders[label] = newA
 		appender = newA
 	}
 
@@ -66,9 +61,26 @@ func (a *prefixAppender) append(resp string, d datum) error {
 	return nil
 }
 
-func (a *prefixAppender) appendWithResponse(resp string, d datum) error {
-	d["ambrosia"] = resp
-	return a.append(resp, d)
+// fileSafe replaces characters in s that aren't safe in a file name.
+func fileSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// paths returns the path of each file written so far, by label.
+func (a *prefixAppender) paths() map[string]string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	ret := make(map[string]string, len(a.appenders))
+	for label, appender := range a.appenders {
+		ret[label] = appender.path
+	}
+	return ret
 }
 
 func (a *prefixAppender) close() error {
@@ -56,12 +56,12 @@ func TestFileAppender(t *testing.T) {
 func TestPrefixAppender(t *testing.T) {
 	t.Run("append data correctly", func(t *testing.T) {
 		// Setup
-		pathTmpl := "test_%[1]c.json"
+		pathTmpl := "test_%[1]s.json"
 		appender := newPrefixAppender(pathTmpl)
 		testDatum := map[string]interface{}{"key": "value"}
 
 		// Execute
-		err := appender.append("test response", testDatum)
+		err := appender.append("t", testDatum)
 
 		// Verify
 		assert.NoError(t, err)
@@ -77,9 +77,9 @@ func TestPrefixAppender(t *testing.T) {
 		assert.NoError(t, err)
 	})
 
-	t.Run("return error if response is empty", func(t *testing.T) {
+	t.Run("return error if label is empty", func(t *testing.T) {
 		// Setup
-		pathTmpl := "test_%[1]c.json"
+		pathTmpl := "test_%[1]s.json"
 		appender := newPrefixAppender(pathTmpl)
 		testDatum := map[string]interface{}{"key": "value"}
 
@@ -93,10 +93,10 @@ func TestPrefixAppender(t *testing.T) {
 
 	t.Run("close correctly", func(t *testing.T) {
 		// Setup
-		pathTmpl := "test_%[1]c.json"
+		pathTmpl := "test_%[1]s.json"
 		appender := newPrefixAppender(pathTmpl)
 		testDatum := map[string]interface{}{"key": "value"}
-		err := appender.append("test response", testDatum)
+		err := appender.append("t", testDatum)
 		assert.NoError(t, err)
 
 		// Execute
@@ -110,3 +110,10 @@ func TestPrefixAppender(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestFileSafe(t *testing.T) {
+	assert.Equal(t, "yes", fileSafe("yes"))
+	assert.Equal(t, "n_a", fileSafe("n/a"))
+	assert.Equal(t, "not_sure", fileSafe("not sure"))
+	assert.Equal(t, "a_b_c", fileSafe(`a\b:c`))
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkpointName is the psort output file that records every datum written
+// to a bucket, so an interrupted run can resume.
+const checkpointName = "checkpoint"
+
+// datumHash returns a stable hash of d.  Map keys are marshalled in sorted
+// order, so the hash doesn't depend on the field order of the input.
+func datumHash(d datum) (string, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// hashData returns the hash of every datum in data.
+func hashData(data []datum) ([]string, error) {
+	ret := make([]string, len(data))
+	for i, d := range data {
+		h, err := datumHash(d)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash line %d: %w", i+1, err)
+		}
+		ret[i] = h
+	}
+	return ret, nil
+}
+
+// completed counts how many times each datum hash has been written by earlier
+// runs, so duplicate data is resumed one copy at a time.
+type completed map[string]int
+
+// loadCheckpoint reads the hashes recorded in a psort checkpoint file.  It
+// returns false if the file doesn't exist.
+func loadCheckpoint(path string) (completed, bool, error) {
+	r, err := newDatumReader(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.close()
+
+	ret := make(completed)
+	for {
+		d, line, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+
+		h, ok := d["hash"].(string)
+		if !ok || h == "" {
+			return nil, false, fmt.Errorf("%s line %d: missing hash", path, line)
+		}
+		ret[h]++
+	}
+
+	return ret, true, nil
+}
+
+// loadLegacyResumable hashes the data in psort outputs written before
+// checkpoints existed, without the "ambrosia" field.  Only files named
+// "<infile>_psort_*" are read, and the errors file is skipped, since failed
+// data is retried.
+func loadLegacyResumable(infilePath string) (completed, error) {
+	dir := filepath.Dir(infilePath)
+	ext := filepath.Ext(infilePath)
+	prefix := strings.TrimSuffix(filepath.Base(infilePath), ext) + "_psort_"
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(completed)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), prefix) || !strings.HasSuffix(f.Name(), ext) {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		if path == psortPath(infilePath, "errors") {
+			continue
+		}
+
+		data, err := load(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range data {
+			delete(d, "ambrosia")
+			h, err := datumHash(d)
+			if err != nil {
+				return nil, err
+			}
+			ret[h]++
+		}
+	}
+
+	return ret, nil
+}
+
+// take reports whether a datum with hash h was already written, and if so
+// marks that copy as used.
+func (c completed) take(h string) bool {
+	if c[h] == 0 {
+		return false
+	}
+	c[h]--
+	return true
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatumHash(t *testing.T) {
+	a, err := datumHash(datum{"input": "foo", "output": "bar"})
+	require.NoError(t, err)
+
+	b, err := datumHash(datum{"output": "bar", "input": "foo"})
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+
+	c, err := datumHash(datum{"input": "foo", "output": "baz"})
+	require.NoError(t, err)
+	assert.NotEqual(t, a, c)
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "in_psort_checkpoint.jsonl")
+
+	_, ok, err := loadCheckpoint(path)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, write(path, []datum{
+		{"line": 1, "hash": "a"},
+		{"line": 2, "hash": "b"},
+		{"line": 3, "hash": "a"},
+	}))
+
+	done, ok, err := loadCheckpoint(path)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, completed{"a": 2, "b": 1}, done)
+
+	assert.True(t, done.take("a"))
+	assert.True(t, done.take("a"))
+	assert.False(t, done.take("a"))
+	assert.True(t, done.take("b"))
+	assert.False(t, done.take("c"))
+
+	bad := filepath.Join(dir, "bad_psort_checkpoint.jsonl")
+	require.NoError(t, write(bad, []datum{{"line": 1}}))
+	_, _, err = loadCheckpoint(bad)
+	assert.ErrorContains(t, err, "line 1: missing hash")
+}
+
+func TestLoadLegacyResumable(t *testing.T) {
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in.jsonl")
+
+	sorted := datum{"input": "foo"}
+	failed := datum{"input": "bar"}
+	other := datum{"input": "baz"}
+
+	require.NoError(t, write(filepath.Join(dir, "in_psort_y.jsonl"), []datum{
+		{"input": "foo", "ambrosia": "yes"},
+	}))
+	require.NoError(t, write(filepath.Join(dir, "in_psort_errors.jsonl"), []datum{
+		{"error": "boom", "datum": failed},
+	}))
+	require.NoError(t, write(filepath.Join(dir, "in_dedupe.jsonl"), []datum{other}))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "in_psort_notes.txt"), []byte("not json"), 0644))
+
+	done, err := loadLegacyResumable(inPath)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		d    datum
+		done bool
+	}{
+		{sorted, true},
+		{failed, false},
+		{other, false},
+	} {
+		h, err := datumHash(tc.d)
+		require.NoError(t, err)
+		assert.Equal(t, tc.done, done.take(h), tc.d)
+	}
+}
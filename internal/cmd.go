@@ -11,11 +11,15 @@ import (
 )
 
 type cmdCtx struct {
-	c       *cli.Context
-	inPath  string
-	outPath string
-	logger  zerolog.Logger
-	data    []datum
+	c           *cli.Context
+	inPath      string
+	outPath     string
+	rejectsPath string
+	logger      zerolog.Logger
+	data        []datum
+
+	// manifest is written next to the output once the command succeeds.
+	manifest manifest
 }
 
 func CmdInit(c *cli.Context) error {
@@ -39,28 +43,45 @@ func CmdInit(c *cli.Context) error {
 		Logger()
 
 	outPath := genOutPath(c.Command.Name, c.Args().Slice())
-	if c.Command.Name != "psort" {
+	if c.Command.Name != "psort" && c.Command.Name != "stats" {
 		logger = logger.With().
 			Str("outfile", outPath).
 			Logger()
 	}
 
-	data, err := load(inPath)
-	if err != nil {
-		return fmt.Errorf("failed to load data: %w", err)
+	ctx := &cmdCtx{
+		c:           c,
+		inPath:      inPath,
+		outPath:     outPath,
+		rejectsPath: c.String("rejects"),
+		logger:      logger,
 	}
 
-	logger = logger.With().Int("in_record_count", len(data)).Logger()
-	logger.Info().Msg("loaded data")
+	// stats only prints a report, so there's nothing to describe.  The input
+	// is hashed while it's loaded or streamed.
+	if c.Command.Name != "stats" {
+		m, err := newManifest(c, inPath)
+		if err != nil {
+			return err
+		}
+		ctx.manifest = m
+	}
 
-	ctx := &cmdCtx{
-		c:       c,
-		inPath:  inPath,
-		outPath: outPath,
-		logger:  logger,
-		data:    data,
+	// Commands that only look at one record at a time stream their input
+	// instead of loading it all into memory.
+	if needsLoad(c) {
+		data, sum, err := loadHashed(inPath)
+		if err != nil {
+			return fmt.Errorf("failed to load data: %w", err)
+		}
+
+		ctx.data = data
+		ctx.manifest.InputSHA256 = sum
+		ctx.logger = ctx.logger.With().Int("in_record_count", len(data)).Logger()
+		ctx.logger.Info().Msg("loaded data")
 	}
 
+	var err error
 	switch c.Command.Name {
 	case "dedupe":
 		err = cmdDedupe(ctx)
@@ -72,13 +93,37 @@ func CmdInit(c *cli.Context) error {
 		err = cmdPSort(ctx)
 	case "whitespace":
 		err = cmdWhitespace(ctx)
+	case "pipeline":
+		err = cmdPipeline(ctx)
+	case "decontam":
+		err = cmdDecontam(ctx)
+	case "stats":
+		err = cmdStats(ctx)
 	}
 
 	if err != nil {
 		return err
 	}
 
+	// psort writes a manifest for each of its output files.
+	if c.Command.Name != "psort" && c.Command.Name != "stats" {
+		if err := ctx.manifest.write(outPath); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+
 	ctx.logger.Info().Msg("done")
 
 	return nil
 }
+
+func needsLoad(c *cli.Context) bool {
+	switch c.Command.Name {
+	case "psort":
+		return true
+	case "dedupe":
+		return c.Bool("rougel") && !c.Bool("minhash")
+	default:
+		return false
+	}
+}
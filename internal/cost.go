@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/reactorsh/ambrosia/providers"
+)
+
+// usage counts the requests sent by psort, and the tokens they used.
+type usage struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// add records a result, counting every attempt as a request.  Only
+// successful responses report tokens.
+func (u *usage) add(res inferResult) {
+	u.Requests += res.attempts
+	if res.err == nil {
+		u.PromptTokens += res.resp.PromptTokens
+		u.CompletionTokens += res.resp.CompletionTokens
+	}
+}
+
+// cost returns the cost of u at the model's prices, or false if the model
+// has no prices.
+func (u usage) cost(m providers.Model) (float64, bool) {
+	if !m.Priced() {
+		return 0, false
+	}
+	return m.Cost(u.PromptTokens, u.CompletionTokens), true
+}
+
+// report prints u under title, with its cost if the model has prices.
+func (u usage) report(w io.Writer, title string, m providers.Model) error {
+	fmt.Fprintf(w, "%s\n", title)
+	fmt.Fprintf(w, "  requests           %d\n", u.Requests)
+	fmt.Fprintf(w, "  prompt tokens      %d\n", u.PromptTokens)
+	fmt.Fprintf(w, "  completion tokens  %d\n", u.CompletionTokens)
+	if cost, ok := u.cost(m); ok {
+		fmt.Fprintf(w, "  cost               %s\n", formatCost(cost))
+	}
+
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// estimateUsage builds the prompt for every datum, to estimate the tokens a
+// run will use before it starts.  lines holds the input line number of each
+// datum, for errors.  Prompt tokens are guessed from their size in bytes, and
+// each response is assumed to use all maxTokens.
+func estimateUsage(data []datum, lines []int, pb *promptBuilder, votes int, maxTokens int) (usage, error) {
+	var u usage
+
+	for i, d := range data {
+		prompt, err := pb.prompt(d)
+		if err != nil {
+			return u, fmt.Errorf("line %d: %w", lines[i], err)
+		}
+
+		sysprompt, err := pb.system(d)
+		if err != nil {
+			return u, fmt.Errorf("line %d: %w", lines[i], err)
+		}
+
+		req := providers.InferRequest{
+			SystemPrompt: sysprompt,
+			Messages:     pb.examples,
+			Prompt:       prompt,
+		}
+
+		u.Requests += votes
+		u.PromptTokens += votes * estimateTokens(&req)
+		u.CompletionTokens += votes * maxTokens
+	}
+
+	return u, nil
+}
+
+// estimateTokens guesses the prompt tokens of req from its size in bytes.
+func estimateTokens(req *providers.InferRequest) int {
+	return (req.ByteCnt() + bytesPerToken - 1) / bytesPerToken
+}
+
+func formatCost(f float64) string {
+	return fmt.Sprintf("%.4f", f)
+}
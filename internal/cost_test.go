@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"text/template"
+
+	"github.com/reactorsh/ambrosia/providers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsage(t *testing.T) {
+	var u usage
+	u.add(inferResult{attempts: 2, resp: &providers.InferResponse{PromptTokens: 100, CompletionTokens: 5}})
+	u.add(inferResult{attempts: 3, err: errors.New("boom")})
+
+	assert.Equal(t, usage{Requests: 5, PromptTokens: 100, CompletionTokens: 5}, u)
+
+	_, ok := u.cost(providers.Model{Name: "free"})
+	assert.False(t, ok)
+
+	cost, ok := u.cost(providers.Model{PromptPrice: 1, CompletionPrice: 2})
+	assert.True(t, ok)
+	assert.InDelta(t, 0.11, cost, 1e-9)
+
+	var buf bytes.Buffer
+	require.NoError(t, u.report(&buf, "usage", providers.Model{PromptPrice: 1, CompletionPrice: 2}))
+	assert.Equal(t, "usage\n"+
+		"  requests           5\n"+
+		"  prompt tokens      100\n"+
+		"  completion tokens  5\n"+
+		"  cost               0.1100\n\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, u.report(&buf, "usage", providers.Model{}))
+	assert.NotContains(t, buf.String(), "cost")
+}
+
+func TestEstimateUsage(t *testing.T) {
+	pb := &promptBuilder{instruction: "Is this a question?", fields: []string{"text"}}
+	data := []datum{{"text": "how are you?"}, {"text": "hello"}}
+
+	u, err := estimateUsage(data, []int{1, 2}, pb, 3, 5)
+	require.NoError(t, err)
+
+	// "Is this a question?\n\ntext: how are you?" is 39 bytes, and
+	// "Is this a question?\n\ntext: hello" is 32.
+	assert.Equal(t, usage{Requests: 6, PromptTokens: 3 * (10 + 8), CompletionTokens: 30}, u)
+
+	// Errors name the input line, not the index in data, which skips the
+	// data already sorted.
+	pb = &promptBuilder{tmpl: template.Must(template.New("t").Parse(`{{ index .list 1 }}`))}
+	data = []datum{{"list": []interface{}{1, 2}}, {"list": []interface{}{1}}}
+	_, err = estimateUsage(data, []int{4, 7}, pb, 1, 5)
+	assert.ErrorContains(t, err, "line 7:")
+}
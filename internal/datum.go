@@ -3,7 +3,6 @@ package internal
 import (
 	"encoding/json"
 	"fmt"
-	"reflect"
 	"strings"
 )
 
@@ -39,28 +38,3 @@ func (d datum) JSON(keys []string) ([]byte, error) {
 
 	return bytes, nil
 }
-
-func isEqual(a datum, b datum) bool {
-	delete(a, "ambrosia")
-	delete(b, "ambrosia")
-	return reflect.DeepEqual(a, b)
-}
-
-func contains(s []datum, e datum) bool {
-	for _, a := range s {
-		if isEqual(a, e) {
-			return true
-		}
-	}
-	return false
-}
-
-func datumSub(a []datum, b []datum) []datum {
-	var ret []datum
-	for _, item := range a {
-		if !contains(b, item) {
-			ret = append(ret, item)
-		}
-	}
-	return ret
-}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+const defaultNgramSize = 13
+
+func cmdDecontam(c *cmdCtx) error {
+	s, err := newDecontamStage(c, c.c)
+	if err != nil {
+		return err
+	}
+
+	in, out, err := stream(c, s.apply)
+	if err != nil {
+		return fmt.Errorf("failed to decontaminate data: %w", err)
+	}
+
+	for _, source := range s.sourceFiles {
+		if s.hits[source] == 0 {
+			continue
+		}
+		c.logger.Info().
+			Str("benchmark", source).
+			Int("contaminated_count", s.hits[source]).
+			Msg("benchmark overlap found")
+	}
+
+	c.logger = c.logger.With().Int("in_record_count", in).Logger()
+	c.logger = c.logger.With().Int("contaminated_count", in-out).Logger()
+	c.logger = c.logger.With().Int("out_record_count", out).Logger()
+	c.logger.Info().Msg("decontaminated data")
+
+	return nil
+}
+
+// decontamStage drops every datum that shares an n-gram of words with any
+// datum in the benchmark files.  Data is formatted with datum.String and
+// lower-cased, as in dedupe.  Benchmark data with fewer than n words in its
+// values is kept whole as a single n-gram, so it's found anywhere in a datum,
+// and benchmark data with no words is skipped.  Only a hash of each benchmark
+// n-gram is kept in memory.
+type decontamStage struct {
+	c      *cmdCtx
+	fields []string
+	n      int
+
+	// ngrams maps n-gram hashes to indexes in sources.  lens lists the n-gram
+	// lengths in it, longest first.
+	ngrams  map[uint64]int
+	lens    []int
+	sources []refSource
+	short   int
+
+	// sourceFiles lists the benchmark files in order, for reporting.  hits
+	// is keyed by the same paths.
+	sourceFiles []string
+	hits        map[string]int
+}
+
+type refSource struct {
+	file   string
+	source string
+}
+
+func newDecontamStage(c *cmdCtx, o options) (*decontamStage, error) {
+	if len(o.StringSlice("benchmarks")) == 0 {
+		return nil, errors.New("must specify at least one --benchmarks file")
+	}
+
+	s := &decontamStage{
+		c:      c,
+		fields: o.StringSlice("fields"),
+		n:      intOr(o, "ngram", defaultNgramSize),
+		ngrams: make(map[uint64]int),
+		hits:   make(map[string]int),
+	}
+
+	if s.n < 1 {
+		return nil, errors.New("ngram must be at least 1")
+	}
+
+	s.sourceFiles = o.StringSlice("benchmarks")
+
+	lens := map[int]bool{s.n: true}
+	err := readRefs(o, "benchmarks", "benchmark-fields", func(r refDatum) error {
+		// Field names are in tokens, so count the words in the values alone.
+		// Without this, an empty field would become an n-gram of just its
+		// name, and match every datum.
+		words := len(strings.Fields(r.d.String(s.fields, false)))
+		if words == 0 {
+			return nil
+		}
+		tokens := s.tokens(r.d)
+
+		s.sources = append(s.sources, refSource{
+			file:   r.path,
+			source: r.source,
+		})
+		idx := len(s.sources) - 1
+
+		n := s.n
+		if words < n {
+			n = len(tokens)
+			lens[n] = true
+			s.short++
+		}
+
+		for i := 0; i+n <= len(tokens); i++ {
+			h := hashNgram(tokens[i : i+n])
+			if _, found := s.ngrams[h]; !found {
+				s.ngrams[h] = idx
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for n := range lens {
+		s.lens = append(s.lens, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(s.lens)))
+
+	c.logger.Info().
+		Int("benchmark_count", len(s.sources)).
+		Int("short_benchmark_count", s.short).
+		Int("ngram_count", len(s.ngrams)).
+		Msg("loaded benchmark n-grams")
+
+	return s, nil
+}
+
+func (s *decontamStage) tokens(d datum) []string {
+	return strings.Fields(strings.ToLower(d.String(s.fields, true)))
+}
+
+func (s *decontamStage) apply(line int, d datum) (string, error) {
+	tokens := s.tokens(d)
+	for _, n := range s.lens {
+		for i := 0; i+n <= len(tokens); i++ {
+			idx, found := s.ngrams[hashNgram(tokens[i:i+n])]
+			if !found {
+				continue
+			}
+
+			src := s.sources[idx]
+			span := strings.Join(tokens[i:i+n], " ")
+			s.hits[src.file]++
+
+			s.c.logger.Debug().
+				Int("line", line).
+				Str("benchmark", src.source).
+				Str("ngram", span).
+				Msg("benchmark overlap found")
+
+			return fmt.Sprintf("benchmark: %s, ngram: %q", src.source, span), nil
+		}
+	}
+
+	return "", nil
+}
+
+func hashNgram(tokens []string) uint64 {
+	h := fnv.New64a()
+	for _, t := range tokens {
+		h.Write([]byte(t))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
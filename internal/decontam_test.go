@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecontamStage(t *testing.T) {
+	dir := t.TempDir()
+	benchPath := filepath.Join(dir, "bench.jsonl")
+	require.NoError(t, write(benchPath, []datum{
+		{"question": "the quick brown fox jumps over the lazy dog"},
+		{"question": "short one"},
+	}))
+
+	newStage := func(t *testing.T, o stageOptions) *decontamStage {
+		o["fields"] = "text"
+		o["benchmarks"] = benchPath
+		o["benchmark-fields"] = "question"
+		s, err := newDecontamStage(&cmdCtx{logger: zerolog.Nop()}, o)
+		require.NoError(t, err)
+		return s
+	}
+
+	t.Run("shared n-gram", func(t *testing.T) {
+		s := newStage(t, stageOptions{"ngram": 4})
+
+		reason, err := s.apply(1, datum{"text": "Yesterday the quick brown Fox ran home"})
+		assert.NoError(t, err)
+		assert.Equal(t, `benchmark: bench.jsonl:1, ngram: "the quick brown fox"`, reason)
+		assert.Equal(t, 1, s.hits[benchPath])
+	})
+
+	t.Run("no shared n-gram", func(t *testing.T) {
+		s := newStage(t, stageOptions{"ngram": 5})
+
+		reason, err := s.apply(1, datum{"text": "yesterday the quick brown fox ran home"})
+		assert.NoError(t, err)
+		assert.Empty(t, reason)
+	})
+
+	t.Run("benchmark shorter than n-gram", func(t *testing.T) {
+		s := newStage(t, stageOptions{})
+		assert.Equal(t, 2, s.short)
+
+		reason, err := s.apply(1, datum{"text": "Short One then more"})
+		assert.NoError(t, err)
+		assert.Equal(t, `benchmark: bench.jsonl:2, ngram: "text: short one"`, reason)
+
+		reason, err = s.apply(2, datum{"text": "short two"})
+		assert.NoError(t, err)
+		assert.Empty(t, reason)
+
+		// Full n-grams still match first.
+		s = newStage(t, stageOptions{"ngram": 4})
+		assert.Equal(t, 1, s.short)
+
+		reason, err = s.apply(3, datum{"text": "short one the quick brown fox"})
+		assert.NoError(t, err)
+		assert.Equal(t, `benchmark: bench.jsonl:1, ngram: "the quick brown fox"`, reason)
+	})
+
+	t.Run("empty benchmark field", func(t *testing.T) {
+		path := filepath.Join(dir, "empty.jsonl")
+		require.NoError(t, write(path, []datum{{"question": ""}, {"question": " "}}))
+
+		s, err := newDecontamStage(&cmdCtx{logger: zerolog.Nop()}, stageOptions{
+			"fields":           "text",
+			"benchmarks":       path,
+			"benchmark-fields": "question",
+		})
+		require.NoError(t, err)
+		assert.Empty(t, s.sources)
+		assert.Zero(t, s.short)
+
+		reason, err := s.apply(1, datum{"text": "anything at all"})
+		assert.NoError(t, err)
+		assert.Empty(t, reason)
+	})
+
+	t.Run("hits by path", func(t *testing.T) {
+		var paths []string
+		for _, sub := range []string{"a", "b"} {
+			path := filepath.Join(dir, sub, "test.jsonl")
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, write(path, []datum{{"question": sub + " question"}}))
+			paths = append(paths, path)
+		}
+
+		s, err := newDecontamStage(&cmdCtx{logger: zerolog.Nop()}, stageOptions{
+			"fields":           "text",
+			"benchmarks":       []string{paths[0], paths[1]},
+			"benchmark-fields": "question",
+		})
+		require.NoError(t, err)
+
+		for _, text := range []string{"a question", "b question", "b question"} {
+			reason, err := s.apply(1, datum{"text": text})
+			require.NoError(t, err)
+			assert.NotEmpty(t, reason)
+		}
+		assert.Equal(t, paths, s.sourceFiles)
+		assert.Equal(t, map[string]int{paths[0]: 1, paths[1]: 2}, s.hits)
+	})
+
+	t.Run("missing benchmarks", func(t *testing.T) {
+		_, err := newDecontamStage(&cmdCtx{logger: zerolog.Nop()}, stageOptions{"fields": "text"})
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid n-gram", func(t *testing.T) {
+		_, err := newDecontamStage(&cmdCtx{logger: zerolog.Nop()}, stageOptions{
+			"fields":     "text",
+			"benchmarks": benchPath,
+			"ngram":      0,
+		})
+		assert.Error(t, err)
+	})
+}
@@ -1,94 +1,223 @@
 package internal
 
 import (
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"os"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/schollz/progressbar/v3"
 )
 
 func cmdDedupe(c *cmdCtx) error {
-	var deduped []datum
-	var err error
-	if c.c.Bool("rl") {
-		deduped, err = dedupeRL(c, c.data)
+	if c.c.IsSet("clusters") && (c.c.Bool("minhash") || !c.c.Bool("rl")) {
+		return errors.New("--clusters requires --rougel without --minhash")
+	}
+
+	if c.c.IsSet("against") && c.c.Bool("minhash") {
+		return errors.New("--against is not supported with --minhash")
+	}
+
+	if c.c.Bool("minhash") || !c.c.Bool("rl") {
+		// Streaming dedupe can only keep the first of each group.
+		if keep := c.c.String("keep"); keep != "" && keep != "first" {
+			return fmt.Errorf("--keep %q requires --rougel without --minhash", keep)
+		}
+
+		var fn recordFn
+		if c.c.Bool("minhash") {
+			s, err := newMinhashStage(c, c.c)
+			if err != nil {
+				return err
+			}
+			fn = s.apply
+		} else {
+			s, err := newDedupeStage(c, c.c)
+			if err != nil {
+				return err
+			}
+			fn = s.apply
+		}
+
+		in, out, err := stream(c, fn)
 		if err != nil {
 			return fmt.Errorf("failed to dedupe data: %w", err)
 		}
-	} else {
-		deduped = dedupe(c, c.data)
+
+		c.logger = c.logger.With().Int("in_record_count", in).Logger()
+		c.logger = c.logger.With().Int("duplicates_found", in-out).Logger()
+		c.logger = c.logger.With().Int("out_record_count", out).Logger()
+		c.logger.Info().Msg("deduped data")
+
+		return nil
 	}
 
-	c.logger = c.logger.With().Int("duplicates_found", len(c.data)-len(deduped)).Logger()
-	c.logger = c.logger.With().Int("out_record_count", len(deduped)).Logger()
+	res, err := dedupeRL(c, c.data)
+	if err != nil {
+		return fmt.Errorf("failed to dedupe data: %w", err)
+	}
+
+	c.logger = c.logger.With().Int("duplicates_found", len(res.rejected)).Logger()
+	c.logger = c.logger.With().Int("out_record_count", len(res.deduped)).Logger()
+	c.logger = c.logger.With().Int("cluster_count", len(res.clusters)).Logger()
 	c.logger.Info().Msg("deduped data")
 
 	c.logger.Info().Msg("writing deduped data")
+	c.manifest.InRecords, c.manifest.OutRecords = len(c.data), len(res.deduped)
 
-	return write(c.outPath, deduped)
-}
+	if err := write(c.outPath, res.deduped); err != nil {
+		return err
+	}
 
-// dedupe could be made more efficient, but it's not worth it for now.
-func dedupe(c *cmdCtx, data []datum) []datum {
-	fields := c.c.StringSlice("fields")
-	ignoreCase := c.c.Bool("ignore-case")
+	// Don't leave a partial set of outputs behind if a side file fails.
+	if c.rejectsPath != "" {
+		c.logger.Info().Str("rejects", c.rejectsPath).Msg("writing rejects")
+		if err := writeRejects(c.rejectsPath, res.rejected); err != nil {
+			os.Remove(c.outPath)
+			return fmt.Errorf("failed to write rejects: %w", err)
+		}
+	}
 
-	// Create keys for each datum based on the fields to dedupe on.
-	var keys []string
-	for _, d := range data {
-		if ignoreCase {
-			keys = append(keys, strings.ToLower(d.String(fields, true)))
-		} else {
-			keys = append(keys, d.String(fields, true))
-		}
-	}
-
-	// Create dedupe set
-	seen := make(map[string]struct{})
-	exists := struct{}{}
-
-	ret := make([]datum, 0)
-
-	for i, d := range keys {
-		if _, found := seen[d]; found {
-			switch {
-			// This is a bug in urfave
-			// https://github.com/urfave/cli/issues/1737
-			case c.c.Count("debug") == 2:
-				c.logger.Debug().
-					Int("line", i+1).
-					Msg("duplicate found")
-			case c.c.Count("debug") >= 3:
-				c.logger.Debug().
-					Int("line", i+1).
-					Interface("data", data[i].String(fields, true)).
-					Msg("duplicate found")
+	if c.c.IsSet("clusters") {
+		c.logger.Info().Str("clusters", c.c.String("clusters")).Msg("writing cluster report")
+		if err := writeClusters(c.c.String("clusters"), res.clusters); err != nil {
+			os.Remove(c.outPath)
+			if c.rejectsPath != "" {
+				os.Remove(c.rejectsPath)
 			}
-			continue
+			return fmt.Errorf("failed to write cluster report: %w", err)
 		}
+	}
 
-		seen[d] = exists
-		ret = append(ret, data[i])
+	return nil
+}
+
+// dedupeStage drops every datum whose fields match an earlier datum, or any
+// datum in the --against reference files.  Only a hash of each key is kept in
+// memory, so this works on files much larger than RAM.
+type dedupeStage struct {
+	c          *cmdCtx
+	fields     []string
+	ignoreCase bool
+	seen       map[[sha256.Size]byte]int
+	against    map[[sha256.Size]byte]string
+}
+
+func newDedupeStage(c *cmdCtx, o options) (*dedupeStage, error) {
+	s := &dedupeStage{
+		c:          c,
+		fields:     o.StringSlice("fields"),
+		ignoreCase: o.Bool("ignore-case"),
+		seen:       make(map[[sha256.Size]byte]int),
+		against:    make(map[[sha256.Size]byte]string),
 	}
 
-	return ret
+	err := readAgainst(o, func(r refDatum) error {
+		hash := s.hash(r.d)
+		if _, found := s.against[hash]; !found {
+			s.against[hash] = r.source
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.against) > 0 {
+		c.logger.Info().Int("reference_count", len(s.against)).Msg("loaded reference data")
+	}
+
+	return s, nil
 }
 
-// dedupeRL is not currently very efficient; this can be improved.
-func dedupeRL(c *cmdCtx, data []datum) ([]datum, error) {
-	pbar := progressbar.DefaultSilent(0)
-	if c.c.Bool("progress") {
-		pbar = progressbar.Default(int64(len(data)))
+func (s *dedupeStage) hash(d datum) [sha256.Size]byte {
+	key := d.String(s.fields, true)
+	if s.ignoreCase {
+		key = strings.ToLower(key)
+	}
+	return sha256.Sum256([]byte(key))
+}
+
+func (s *dedupeStage) apply(line int, d datum) (string, error) {
+	hash := s.hash(d)
+	if source, found := s.against[hash]; found {
+		s.c.logger.Debug().
+			Int("line", line).
+			Str("duplicate_of", source).
+			Msg("reference duplicate found")
+		return "duplicate_of: " + source, nil
+	}
+
+	if orig, found := s.seen[hash]; found {
+		switch {
+		// This is a bug in urfave
+		// https://github.com/urfave/cli/issues/1737
+		case s.c.c.Count("debug") == 2:
+			s.c.logger.Debug().
+				Int("line", line).
+				Msg("duplicate found")
+		case s.c.c.Count("debug") >= 3:
+			s.c.logger.Debug().
+				Int("line", line).
+				Interface("data", d.String(s.fields, true)).
+				Msg("duplicate found")
+		}
+		return fmt.Sprintf("duplicate_of: %d", orig), nil
 	}
 
+	s.seen[hash] = line
+	return "", nil
+}
+
+// rlEdge joins two data with a ROUGE-L score above the threshold.
+type rlEdge struct {
+	i, j  int
+	score float64
+}
+
+type rlResult struct {
+	deduped  []datum
+	rejected []reject
+	clusters []rlCluster
+}
+
+// rlCluster is a kept datum and the near-duplicates dropped in its favor.
+// Lines are line numbers in the input file.
+type rlCluster struct {
+	Representative int      `json:"representative"`
+	Members        []int    `json:"members"`
+	Pairs          []rlPair `json:"pairs"`
+}
+
+// rlPair is a ROUGE-L score above the threshold between two cluster members.
+type rlPair struct {
+	A      int     `json:"a"`
+	B      int     `json:"b"`
+	RougeL float64 `json:"rougel"`
+}
+
+// dedupeRL is not currently very efficient; this can be improved.  Use
+// --minhash for large datasets.
+//
+// Data are kept in the order given by --keep, dropping any datum similar to
+// one that has already been kept.  Each datum is only compared with the data
+// already kept, unless a cluster report is requested, which needs every pair
+// above the threshold.  The output is in input order and is the same between
+// runs.
+func dedupeRL(c *cmdCtx, data []datum) (*rlResult, error) {
 	fields := c.c.StringSlice("fields")
-	thresh := c.c.Float64("rl-threshold")
 
-	var loweredFields [][]string
-	var deduped []datum
+	order, err := keepOrder(c.c.String("keep"), data, fields)
+	if err != nil {
+		return nil, err
+	}
 
+	var loweredFields [][]string
 	for _, d := range data {
 		strD := d.String(fields, true)
 		lstrD := strings.ToLower(strD)
@@ -96,62 +225,326 @@ func dedupeRL(c *cmdCtx, data []datum) ([]datum, error) {
 		loweredFields = append(loweredFields, lfS)
 	}
 
+	var againstReasons []string
+	if c.c.IsSet("against") {
+		againstReasons, err = rougeLAgainst(c, loweredFields)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	thresh := c.c.Float64("rl-threshold")
+
+	// match finds the kept datum most similar to i, preferring the earliest
+	// on ties.
+	var match func(i int, kept []bool, keptIdx []int) (rlEdge, bool)
+
+	var edges []rlEdge
+	pbar := progressbar.DefaultSilent(0)
+	if c.c.IsSet("clusters") {
+		edges = rougeLEdges(c, loweredFields)
+
+		// Neighbors are ordered by index, as edges are ordered by i then j.
+		neighbors := make([][]rlEdge, len(data))
+		for _, e := range edges {
+			neighbors[e.i] = append(neighbors[e.i], e)
+			neighbors[e.j] = append(neighbors[e.j], rlEdge{i: e.j, j: e.i, score: e.score})
+		}
+
+		match = func(i int, kept []bool, _ []int) (rlEdge, bool) {
+			var best *rlEdge
+			for k, e := range neighbors[i] {
+				if kept[e.j] && (best == nil || e.score > best.score) {
+					best = &neighbors[i][k]
+				}
+			}
+			if best == nil {
+				return rlEdge{}, false
+			}
+			return *best, true
+		}
+	} else {
+		if c.c.Bool("progress") {
+			pbar = progressbar.Default(int64(len(data)))
+		}
+
+		match = func(i int, _ []bool, keptIdx []int) (rlEdge, bool) {
+			return rougeLBest(loweredFields, i, keptIdx, thresh)
+		}
+	}
+
+	kept := make([]bool, len(data))
+	var keptIdx []int
+	reasons := make([]string, len(data))
+	dupOf := make([]int, len(data))
+	for _, i := range order {
+		if c.c.Bool("progress") {
+			pbar.Add(1)
+		}
+
+		if againstReasons != nil && againstReasons[i] != "" {
+			reasons[i] = againstReasons[i]
+			dupOf[i] = -1
+			continue
+		}
+
+		// Empty data are never compared, so nothing can be dropped in their
+		// favor.
+		if len(loweredFields[i]) == 0 {
+			c.logger.Debug().
+				Int("line", i+1).
+				Msg("empty field, not comparing")
+			kept[i] = true
+			continue
+		}
+
+		// Drop i if it's similar to anything already kept, naming the most
+		// similar one.
+		best, found := match(i, kept, keptIdx)
+		if !found {
+			kept[i] = true
+			keptIdx = append(keptIdx, i)
+			continue
+		}
+
+		c.logger.Debug().
+			Int("line", i+1).
+			Int("duplicate_of", best.j+1).
+			Float64("roguel", best.score).
+			Msg("duplicate found")
+		reasons[i] = fmt.Sprintf("duplicate_of: %d, rougel: %.2f", best.j+1, best.score)
+		dupOf[i] = best.j
+	}
+
+	res := &rlResult{}
+	for i, d := range data {
+		if !kept[i] {
+			res.rejected = append(res.rejected, reject{Line: i + 1, Reason: reasons[i], Datum: d})
+			continue
+		}
+		res.deduped = append(res.deduped, d)
+	}
+
+	if edges != nil {
+		res.clusters = rlClusters(kept, dupOf, edges)
+	}
+
+	return res, nil
+}
+
+// rlParallelMin is the number of kept data below which rougeLBest compares
+// on a single goroutine.
+const rlParallelMin = 256
+
+// rougeLBest returns the datum in kept with the highest ROUGE-L score with
+// tokens[i] above thresh, preferring the earliest on ties.  Large kept sets
+// are split between goroutines.
+func rougeLBest(tokens [][]string, i int, kept []int, thresh float64) (rlEdge, bool) {
+	workers := runtime.NumCPU()
+	if len(kept) < rlParallelMin {
+		workers = 1
+	}
+	size := (len(kept) + workers - 1) / workers
+
+	bests := make([]rlEdge, workers)
 	var wg sync.WaitGroup
-	dedupedChan := make(chan datum, len(data))
+	for w := range bests {
+		bests[w] = rlEdge{i: i, j: -1}
 
-	numCPU := runtime.NumCPU()
-	chunkSize := (len(loweredFields) + numCPU - 1) / numCPU
-	for i := 0; i < len(loweredFields); i += chunkSize {
-		end := i + chunkSize
-		if end > len(loweredFields) {
-			end = len(loweredFields)
+		lo, hi := w*size, (w+1)*size
+		if hi > len(kept) {
+			hi = len(kept)
 		}
+		if lo >= hi {
+			continue
+		}
+
 		wg.Add(1)
-		go func(i, end int) {
+		go func(best *rlEdge, kept []int) {
 			defer wg.Done()
-			for ; i < end; i++ {
+			for _, k := range kept {
+				rl := rougeL(tokens[i], tokens[k])
+				if rl > thresh && best.better(rl, k) {
+					*best = rlEdge{i: i, j: k, score: rl}
+				}
+			}
+		}(&bests[w], kept[lo:hi])
+	}
+	wg.Wait()
+
+	best := rlEdge{i: i, j: -1}
+	for _, b := range bests {
+		if b.j >= 0 && best.better(b.score, b.j) {
+			best = b
+		}
+	}
+
+	return best, best.j >= 0
+}
+
+// better reports whether a match with j at score beats e, where a j of -1
+// means no match yet.
+func (e rlEdge) better(score float64, j int) bool {
+	return e.j < 0 || score > e.score || (score == e.score && j < e.j)
+}
+
+// rlClusters groups each kept datum with the data dropped in its favor.
+// Clusters are ordered by representative, and only include the pairs whose
+// members are both in the cluster.
+func rlClusters(kept []bool, dupOf []int, edges []rlEdge) []rlCluster {
+	rep := make([]int, len(kept))
+	members := make(map[int][]int)
+	for i := range kept {
+		rep[i] = i
+		if !kept[i] {
+			// Data dropped for matching a reference aren't in a cluster.
+			rep[i] = dupOf[i]
+			if rep[i] >= 0 {
+				members[rep[i]] = append(members[rep[i]], i)
+			}
+		}
+	}
+
+	pairs := make(map[int][]rlPair)
+	for _, e := range edges {
+		if rep[e.i] < 0 || rep[e.i] != rep[e.j] {
+			continue
+		}
+		pairs[rep[e.i]] = append(pairs[rep[e.i]], rlPair{A: e.i + 1, B: e.j + 1, RougeL: e.score})
+	}
+
+	var ret []rlCluster
+	for i := range kept {
+		if !kept[i] || len(members[i]) == 0 {
+			continue
+		}
+
+		lines := []int{i + 1}
+		for _, m := range members[i] {
+			lines = append(lines, m+1)
+		}
+		sort.Ints(lines)
+
+		ret = append(ret, rlCluster{
+			Representative: i + 1,
+			Members:        lines,
+			Pairs:          pairs[i],
+		})
+	}
+
+	return ret
+}
+
+// writeClusters writes the cluster report to a new file at path, removing it
+// if writing fails.
+func writeClusters(path string, clusters []rlCluster) (err error) {
+	w, err := newDatumWriter(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := w.close()
+		if closeErr != nil && err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	for _, cl := range clusters {
+		if err := w.writeValue(cl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rougeLEdges compares every pair of token lists in parallel and returns the
+// pairs with a ROUGE-L score above --rl-threshold, ordered by i then j.
+// Empty token lists are never compared.
+func rougeLEdges(c *cmdCtx, tokens [][]string) []rlEdge {
+	pbar := progressbar.DefaultSilent(0)
+	if c.c.Bool("progress") {
+		pbar = progressbar.Default(int64(len(tokens)))
+	}
+
+	thresh := c.c.Float64("rl-threshold")
+
+	// Each row is only written by the goroutine that compares it.
+	rows := make([][]rlEdge, len(tokens))
+
+	// Earlier rows have more comparisons, so hand out rows one at a time
+	// instead of in fixed chunks.
+	var next int64 = -1
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(tokens) {
+					return
+				}
 				if c.c.Bool("progress") {
 					pbar.Add(1)
 				}
-				d1 := loweredFields[i]
+
+				d1 := tokens[i]
 				if len(d1) == 0 {
-					c.logger.Debug().
-						Int("line", i).
-						Msg("empty field, not comparing")
-					dedupedChan <- data[i]
 					continue
 				}
 
-				isDuplicate := false
-				for j := i + 1; j < len(loweredFields); j++ {
-					d2 := loweredFields[j]
-
-					rl := rougeL(d1, d2)
+				for j := i + 1; j < len(tokens); j++ {
+					rl := rougeL(d1, tokens[j])
 					if rl > thresh {
-						c.logger.Debug().
-							Str("d1", strings.Join(d1, " ")).
-							Str("d2", strings.Join(d2, " ")).
-							Float64("roguel", rl).
-							Msg("duplicate found")
-						isDuplicate = true
-						break
+						rows[i] = append(rows[i], rlEdge{i: i, j: j, score: rl})
 					}
 				}
-
-				if !isDuplicate {
-					dedupedChan <- data[i]
-				}
 			}
-		}(i, end)
+		}()
+	}
+	wg.Wait()
+
+	var ret []rlEdge
+	for _, row := range rows {
+		ret = append(ret, row...)
+	}
+
+	return ret
+}
+
+// keepOrder returns the indexes of data in the order they should be
+// considered for keeping, according to policy.
+func keepOrder(policy string, data []datum, fields []string) ([]int, error) {
+	order := make([]int, len(data))
+	for i := range order {
+		order[i] = i
+	}
+
+	lengths := make([]int, len(data))
+	for i, d := range data {
+		lengths[i] = calculateStringLength(d, fields...)
 	}
-	go func() {
-		wg.Wait()
-		close(dedupedChan)
-	}()
 
-	for d := range dedupedChan {
-		deduped = append(deduped, d)
+	switch policy {
+	case "", "first":
+	case "last":
+		sort.Sort(sort.Reverse(sort.IntSlice(order)))
+	case "longest":
+		sort.SliceStable(order, func(a, b int) bool {
+			return lengths[order[a]] > lengths[order[b]]
+		})
+	case "shortest":
+		sort.SliceStable(order, func(a, b int) bool {
+			return lengths[order[a]] < lengths[order[b]]
+		})
+	default:
+		return nil, fmt.Errorf("invalid --keep %q, must be one of first, last, longest, shortest", policy)
 	}
 
-	return deduped, nil
+	return order, nil
 }
@@ -4,12 +4,14 @@ import (
 	"encoding/json"
 	"flag"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"testing"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/urfave/cli/v2"
 )
 
@@ -44,8 +46,9 @@ func TestDedupeRL(t *testing.T) {
 		data := []datum{
 			{"testField": ""},
 		}
-		result, err := dedupeRL(&cmdCtx{c: ctx}, data)
+		res, err := dedupeRL(&cmdCtx{c: ctx}, data)
 		assert.NoError(t, err)
+		result := res.deduped
 		assert.Equal(t, data, result)
 	})
 
@@ -54,8 +57,9 @@ func TestDedupeRL(t *testing.T) {
 			{"testField": "test1"},
 			{"testField": "test2"},
 		}
-		result, err := dedupeRL(&cmdCtx{c: ctx}, data)
+		res, err := dedupeRL(&cmdCtx{c: ctx}, data)
 		assert.NoError(t, err)
+		result := res.deduped
 		assert.Len(t, result, 2)
 	})
 
@@ -64,8 +68,9 @@ func TestDedupeRL(t *testing.T) {
 			{"testField": "test"},
 			{"testField": "test"},
 		}
-		result, err := dedupeRL(&cmdCtx{c: ctx}, data)
+		res, err := dedupeRL(&cmdCtx{c: ctx}, data)
 		assert.NoError(t, err)
+		result := res.deduped
 		assert.Equal(t, []datum{{"testField": "test"}}, result)
 	})
 
@@ -74,8 +79,9 @@ func TestDedupeRL(t *testing.T) {
 			{"testField": "test"},
 			{"testField": "TEST"},
 		}
-		result, err := dedupeRL(&cmdCtx{c: ctx}, data)
+		res, err := dedupeRL(&cmdCtx{c: ctx}, data)
 		assert.NoError(t, err)
+		result := res.deduped
 		assert.Len(t, result, 1)
 	})
 
@@ -84,8 +90,9 @@ func TestDedupeRL(t *testing.T) {
 			{"testField": "This is a test."},
 			{"testField": "This is also a test."},
 		}
-		result, err := dedupeRL(&cmdCtx{c: ctx}, data)
+		res, err := dedupeRL(&cmdCtx{c: ctx}, data)
 		assert.NoError(t, err)
+		result := res.deduped
 		assert.Len(t, result, 1)
 	})
 
@@ -93,8 +100,9 @@ func TestDedupeRL(t *testing.T) {
 		data := []datum{
 			{"testField": 1234},
 		}
-		result, err := dedupeRL(&cmdCtx{c: ctx}, data)
+		res, err := dedupeRL(&cmdCtx{c: ctx}, data)
 		assert.NoError(t, err)
+		result := res.deduped
 		assert.Equal(t, data, result)
 	})
 
@@ -102,12 +110,153 @@ func TestDedupeRL(t *testing.T) {
 		data := []datum{
 			{"otherField": "test"},
 		}
-		result, err := dedupeRL(&cmdCtx{c: ctx}, data)
+		res, err := dedupeRL(&cmdCtx{c: ctx}, data)
 		assert.NoError(t, err)
+		result := res.deduped
+		assert.Equal(t, data, result)
+	})
+
+	t.Run("rejected data has line and reason", func(t *testing.T) {
+		data := []datum{
+			{"testField": "test"},
+			{"testField": "other"},
+			{"testField": "test"},
+		}
+		res, err := dedupeRL(&cmdCtx{c: ctx}, data)
+		assert.NoError(t, err)
+		assert.Equal(t, []reject{
+			{Line: 3, Reason: "duplicate_of: 1, rougel: 1.00", Datum: datum{"testField": "test"}},
+		}, res.rejected)
+	})
+
+	t.Run("output is in input order", func(t *testing.T) {
+		var data []datum
+		for i := 0; i < 200; i++ {
+			data = append(data, datum{"testField": "unique record number " + strconv.Itoa(i)})
+		}
+		res, err := dedupeRL(&cmdCtx{c: ctx}, data)
+		assert.NoError(t, err)
+		result := res.deduped
 		assert.Equal(t, data, result)
 	})
 }
 
+func TestDedupeRLKeep(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	data := []datum{
+		{"testField": "the quick brown fox jumps"},
+		{"testField": "something else entirely"},
+		{"testField": "the quick brown fox jumps over"},
+		{"testField": "the quick brown fox jumps over it all"},
+		{"testField": "the quick brown fox"},
+	}
+
+	testCases := []struct {
+		keep     string
+		expected []datum
+	}{
+		{keep: "", expected: []datum{data[0], data[1]}},
+		{keep: "first", expected: []datum{data[0], data[1]}},
+		{keep: "last", expected: []datum{data[1], data[4]}},
+		{keep: "longest", expected: []datum{data[1], data[3]}},
+		{keep: "shortest", expected: []datum{data[1], data[4]}},
+	}
+
+	for _, tc := range testCases {
+		// Collecting edges for a cluster report mustn't change what's kept.
+		for _, clusters := range []bool{false, true} {
+			name := "keep " + tc.keep
+			if clusters {
+				name += " with clusters"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				set := flag.NewFlagSet("test", 0)
+				set.Var(cli.NewStringSlice("testField"), "fields", "doc")
+				set.Float64("rl-threshold", 0.7, "doc")
+				set.String("keep", tc.keep, "doc")
+				set.String("clusters", "", "doc")
+				if clusters {
+					assert.NoError(t, set.Set("clusters", "clusters.jsonl"))
+				}
+				ctx := cli.NewContext(cli.NewApp(), set, nil)
+
+				res, err := dedupeRL(&cmdCtx{c: ctx}, data)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, res.deduped)
+				assert.Len(t, res.rejected, len(data)-len(tc.expected))
+				if !clusters {
+					assert.Empty(t, res.clusters)
+				}
+			})
+		}
+	}
+
+	t.Run("clusters", func(t *testing.T) {
+		set := flag.NewFlagSet("test", 0)
+		set.Var(cli.NewStringSlice("testField"), "fields", "doc")
+		set.Float64("rl-threshold", 0.7, "doc")
+		set.String("clusters", "", "doc")
+		assert.NoError(t, set.Set("clusters", "clusters.jsonl"))
+		ctx := cli.NewContext(cli.NewApp(), set, nil)
+
+		res, err := dedupeRL(&cmdCtx{c: ctx}, data)
+		assert.NoError(t, err)
+		assert.Equal(t, []rlCluster{
+			{
+				Representative: 1,
+				Members:        []int{1, 3, 4, 5},
+				Pairs: []rlPair{
+					{A: 1, B: 3, RougeL: 12.0 / 13.0},
+					{A: 1, B: 4, RougeL: 12.0 / 15.0},
+					{A: 1, B: 5, RougeL: 10.0 / 11.0},
+					{A: 3, B: 4, RougeL: 14.0 / 16.0},
+					{A: 3, B: 5, RougeL: 10.0 / 12.0},
+					{A: 4, B: 5, RougeL: 10.0 / 14.0},
+				},
+			},
+		}, res.clusters)
+	})
+
+	t.Run("many kept", func(t *testing.T) {
+		var many []datum
+		for i := 0; i < 2*rlParallelMin; i++ {
+			many = append(many, datum{"testField": strconv.Itoa(i) + " " + strconv.Itoa(i*7) + " " + strconv.Itoa(i*13)})
+		}
+		many = append(many, many[5], many[len(many)-1])
+
+		for _, clusters := range []string{"", "clusters.jsonl"} {
+			set := flag.NewFlagSet("test", 0)
+			set.Var(cli.NewStringSlice("testField"), "fields", "doc")
+			set.Float64("rl-threshold", 0.7, "doc")
+			set.String("clusters", "", "doc")
+			if clusters != "" {
+				assert.NoError(t, set.Set("clusters", clusters))
+			}
+			ctx := cli.NewContext(cli.NewApp(), set, nil)
+
+			res, err := dedupeRL(&cmdCtx{c: ctx}, many)
+			assert.NoError(t, err)
+			assert.Len(t, res.deduped, 2*rlParallelMin)
+			if assert.Len(t, res.rejected, 2) {
+				assert.Equal(t, "duplicate_of: 6, rougel: 1.00", res.rejected[0].Reason)
+				assert.Equal(t, "duplicate_of: 512, rougel: 1.00", res.rejected[1].Reason)
+			}
+		}
+	})
+
+	t.Run("invalid keep", func(t *testing.T) {
+		set := flag.NewFlagSet("test", 0)
+		set.Var(cli.NewStringSlice("testField"), "fields", "doc")
+		set.String("keep", "middle", "doc")
+		ctx := cli.NewContext(cli.NewApp(), set, nil)
+
+		_, err := dedupeRL(&cmdCtx{c: ctx}, data)
+		assert.Error(t, err)
+	})
+}
+
 func TestDedupe(t *testing.T) {
 	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
 
@@ -132,7 +281,7 @@ func TestDedupe(t *testing.T) {
 			{"name": "Bob", "age": 30},
 		}
 
-		assert.Equal(t, expected, dedupe(ctx, data))
+		assert.Equal(t, expected, applyRecordFn(t, mustDedupeStage(t, ctx).apply, data))
 	})
 
 	t.Run("dedupe should apply ignore-case flag", func(t *testing.T) {
@@ -155,7 +304,28 @@ func TestDedupe(t *testing.T) {
 			{"name": "Alice", "age": 25},
 		}
 
-		assert.Equal(t, expected, dedupe(ctx, data))
+		assert.Equal(t, expected, applyRecordFn(t, mustDedupeStage(t, ctx).apply, data))
+	})
+
+	t.Run("dedupe should give the line of the original", func(t *testing.T) {
+		app := cli.NewApp()
+		set := flag.NewFlagSet("test", 0)
+		set.Var(cli.NewStringSlice("name"), "fields", "doc")
+		ctx := &cmdCtx{
+			c:      cli.NewContext(app, set, nil),
+			logger: logger,
+		}
+
+		s := mustDedupeStage(t, ctx)
+		for i, name := range []string{"Alice", "Bob", "Alice"} {
+			reason, err := s.apply(i+1, datum{"name": name})
+			assert.NoError(t, err)
+			if i == 2 {
+				assert.Equal(t, "duplicate_of: 1", reason)
+			} else {
+				assert.Empty(t, reason)
+			}
+		}
 	})
 
 	t.Run("dedupe should handle empty slice", func(t *testing.T) {
@@ -170,7 +340,7 @@ func TestDedupe(t *testing.T) {
 			data:   data,
 		}
 
-		assert.Equal(t, data, dedupe(ctx, data))
+		assert.Equal(t, data, applyRecordFn(t, mustDedupeStage(t, ctx).apply, data))
 	})
 
 	t.Run("dedupe should handle no duplicate entries", func(t *testing.T) {
@@ -188,7 +358,7 @@ func TestDedupe(t *testing.T) {
 			data:   data,
 		}
 
-		assert.Equal(t, data, dedupe(ctx, data))
+		assert.Equal(t, data, applyRecordFn(t, mustDedupeStage(t, ctx).apply, data))
 	})
 
 	t.Run("dedupe should check only the requested fields", func(t *testing.T) {
@@ -214,7 +384,7 @@ func TestDedupe(t *testing.T) {
 			{"name": "Bob", "age": 30, "city": "New York"},
 		}
 
-		assert.Equal(t, expected, dedupe(ctx, data))
+		assert.Equal(t, expected, applyRecordFn(t, mustDedupeStage(t, ctx).apply, data))
 	})
 }
 
@@ -276,3 +446,63 @@ func TestDatum_JSON(t *testing.T) {
 		})
 	}
 }
+
+func TestCmdDedupeRL(t *testing.T) {
+	data := []datum{
+		{"text": "the quick brown fox jumps"},
+		{"text": "something else entirely"},
+		{"text": "the quick brown fox jumps over"},
+	}
+
+	newCtx := func(t *testing.T, args ...string) *cmdCtx {
+		tempDir := t.TempDir()
+
+		set := flag.NewFlagSet("test", 0)
+		set.Var(cli.NewStringSlice("text"), "fields", "doc")
+		set.Float64("rl-threshold", 0.7, "doc")
+		set.Bool("rl", true, "doc")
+		set.Bool("minhash", false, "doc")
+		set.String("keep", "first", "doc")
+		set.String("clusters", "", "doc")
+		require.NoError(t, set.Parse(args))
+
+		return &cmdCtx{
+			c:           cli.NewContext(cli.NewApp(), set, nil),
+			outPath:     filepath.Join(tempDir, "output.jsonl"),
+			rejectsPath: filepath.Join(tempDir, "rejects.jsonl"),
+			logger:      zerolog.Nop(),
+			data:        data,
+		}
+	}
+
+	t.Run("failed rejects removes output", func(t *testing.T) {
+		c := newCtx(t)
+		require.NoError(t, os.WriteFile(c.rejectsPath, []byte("existing\n"), 0644))
+
+		assert.Error(t, cmdDedupe(c))
+		assert.NoFileExists(t, c.outPath)
+
+		// The existing file isn't ours to remove.
+		b, err := os.ReadFile(c.rejectsPath)
+		assert.NoError(t, err)
+		assert.Equal(t, "existing\n", string(b))
+	})
+	t.Run("failed cluster report removes other outputs", func(t *testing.T) {
+		clustersPath := filepath.Join(t.TempDir(), "clusters.jsonl")
+		require.NoError(t, os.WriteFile(clustersPath, []byte("existing\n"), 0644))
+
+		c := newCtx(t, "--clusters", clustersPath)
+
+		assert.Error(t, cmdDedupe(c))
+		assert.NoFileExists(t, c.outPath)
+		assert.NoFileExists(t, c.rejectsPath)
+
+		b, err := os.ReadFile(clustersPath)
+		assert.NoError(t, err)
+		assert.Equal(t, "existing\n", string(b))
+	})
+	t.Run("keep with minhash", func(t *testing.T) {
+		assert.ErrorContains(t, cmdDedupe(newCtx(t, "--minhash", "--keep", "longest")), "--keep")
+		assert.ErrorContains(t, cmdDedupe(newCtx(t, "--rl=false", "--keep", "last")), "--keep")
+	})
+}
@@ -2,38 +2,97 @@ package internal
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
+	"io"
 	"os"
-	"path/filepath"
-	"strings"
 )
 
 func load(path string) ([]datum, error) {
-	file, err := os.Open(path)
+	data, _, err := loadHashed(path)
+	return data, err
+}
+
+// loadHashed loads the file at path, and returns the SHA-256 of its contents
+// as well.
+func loadHashed(path string) ([]datum, string, error) {
+	r, err := newDatumReader(path)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	defer file.Close()
+	defer r.close()
 
 	var data []datum
 
-	scanner := bufio.NewScanner(file)
-	scanner.Buffer(nil, 10*1024*1024)
-
-	for scanner.Scan() {
-		var d datum
-		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
-			return nil, fmt.Errorf("%w: are you using a valid JSONL file?", err)
+	for {
+		d, _, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", err
 		}
 		data = append(data, d)
 	}
 
-	if err := scanner.Err(); err != nil {
+	return data, r.sum(), nil
+}
+
+// datumReader reads a JSONL file one datum at a time.  The bytes read are
+// hashed as they go, so a file can be hashed without reading it twice.
+type datumReader struct {
+	file    *os.File
+	hash    hash.Hash
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newDatumReader(path string) (*datumReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
 		return nil, err
 	}
 
-	return data, nil
+	h := sha256.New()
+	scanner := bufio.NewScanner(io.TeeReader(file, h))
+	scanner.Buffer(nil, 10*1024*1024)
+
+	return &datumReader{
+		file:    file,
+		hash:    h,
+		scanner: scanner,
+	}, nil
+}
+
+// sum returns the SHA-256 of the file, once next has returned io.EOF.
+func (r *datumReader) sum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
+
+// next returns the next datum and its line number, starting at 1.  It returns
+// io.EOF once the file has been fully read.
+func (r *datumReader) next() (datum, int, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return nil, r.line, err
+		}
+		return nil, r.line, io.EOF
+	}
+	r.line++
+
+	var d datum
+	if err := json.Unmarshal(r.scanner.Bytes(), &d); err != nil {
+		return nil, r.line, fmt.Errorf("%w: are you using a valid JSONL file?", err)
+	}
+
+	return d, r.line, nil
+}
+
+func (r *datumReader) close() error {
+	return r.file.Close()
 }
 
 func loadWordlist(path string) ([]string, error) {
@@ -57,65 +116,141 @@ func loadWordlist(path string) ([]string, error) {
 	return ret, nil
 }
 
-func loadResumable(cmd string, infilePath string) ([]datum, error) {
-	searchPath := filepath.Dir(infilePath)
-	searchPrefix := searchPrefix(infilePath)
-
-	var resumableFiles []string
-	files, err := os.ReadDir(searchPath)
+// write writes data to a new file at path, removing it if writing fails.
+func write(path string, data []datum) (err error) {
+	w, err := newDatumWriter(path)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	for _, f := range files {
-		if !f.IsDir() && strings.HasPrefix(f.Name(), searchPrefix) {
-			resumableFiles = append(resumableFiles, filepath.Join(searchPath, f.Name()))
+	defer func() {
+		closeErr := w.close()
+		if closeErr != nil && err == nil {
+			err = closeErr
 		}
-	}
-
-	var ret []datum
-
-	for _, f := range resumableFiles {
-		data, err := load(f)
 		if err != nil {
-			return nil, err
+			os.Remove(path)
+		}
+	}()
+
+	for _, d := range data {
+		if err := w.write(d); err != nil {
+			return err
 		}
-		ret = append(ret, data...)
 	}
 
-	return ret, nil
+	return nil
 }
 
-func write(path string, data []datum) (err error) {
+// datumWriter writes data to a new JSONL file one datum at a time.
+type datumWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+}
+
+func newDatumWriter(path string) (*datumWriter, error) {
 	// Error if the file already exists.
 	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &datumWriter{
+		file: file,
+		buf:  bufio.NewWriter(file),
+	}, nil
+}
+
+func (w *datumWriter) write(d datum) error {
+	return w.writeValue(d)
+}
+
+// writeValue writes any JSON-marshallable value as a single line.
+func (w *datumWriter) writeValue(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.buf.Write(append(b, '\n'))
+	return err
+}
+
+func (w *datumWriter) close() error {
+	flushErr := w.buf.Flush()
+	closeErr := w.file.Close()
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+// writeRejects writes rejected data to a new file at path, removing it if
+// writing fails.
+func writeRejects(path string, rejected []reject) (err error) {
+	rw, err := newRejectWriter(path)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		closeErr := file.Close()
+		closeErr := rw.close()
 		if closeErr != nil && err == nil {
 			err = closeErr
 		}
-	}()
-
-	writer := bufio.NewWriter(file)
-	defer func() {
-		flushErr := writer.Flush()
-		if flushErr != nil && err == nil {
-			err = flushErr
+		if err != nil {
+			os.Remove(path)
 		}
 	}()
 
-	for _, d := range data {
-		b, err := json.Marshal(d)
-		if err != nil {
-			return err
-		}
-		if _, err := writer.Write(append(b, '\n')); err != nil {
+	for _, r := range rejected {
+		if err := rw.write(r.Line, r.Reason, r.Datum); err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
+
+// reject is a single dropped datum, as written to a rejects file.
+type reject struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+	Datum  datum  `json:"datum"`
+}
+
+// rejectWriter writes dropped data to a rejects file.  A nil *rejectWriter
+// discards everything written to it.
+type rejectWriter struct {
+	w *datumWriter
+}
+
+// newRejectWriter returns a nil *rejectWriter if path is empty.
+func newRejectWriter(path string) (*rejectWriter, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	w, err := newDatumWriter(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rejects file: %w", err)
+	}
+
+	return &rejectWriter{w: w}, nil
+}
+
+func (rw *rejectWriter) write(line int, reason string, d datum) error {
+	if rw == nil {
+		return nil
+	}
+
+	return rw.w.writeValue(reject{
+		Line:   line,
+		Reason: reason,
+		Datum:  d,
+	})
+}
+
+func (rw *rejectWriter) close() error {
+	if rw == nil {
+		return nil
+	}
+	return rw.w.close()
+}
@@ -1,10 +1,8 @@
 package internal
 
 import (
-	"encoding/json"
 	"os"
 	"path/filepath"
-	"strconv"
 	"testing"
 	"time"
 
@@ -74,67 +72,6 @@ func TestWrite(t *testing.T) {
 	})
 }
 
-func TestLoadResumable(t *testing.T) {
-	assert := assert.New(t)
-
-	// Create a temporary directory
-	tmpDir, err := os.MkdirTemp("", "test")
-	assert.NoError(err)
-
-	// Ensure the temporary directory is cleaned up
-	defer os.RemoveAll(tmpDir)
-
-	// Create test data
-	datum1 := datum{"key1": "value1", "key2": "value2"}
-	datum2 := datum{"key3": "value3", "key4": "value4"}
-	datum3 := datum{"key5": "value5", "key6": "value6"}
-
-	// Create resumable files
-	for i, d := range []datum{datum1, datum2} {
-		f, err := os.Create(filepath.Join(tmpDir, "testFile_"+strconv.Itoa(i)+".jsonl"))
-		assert.NoError(err)
-
-		data, err := json.Marshal(d)
-		assert.NoError(err)
-
-		_, err = f.WriteString(string(data) + "\n")
-		assert.NoError(err)
-
-		f.Close()
-	}
-
-	// Create non-resumable file
-	f, err := os.Create(filepath.Join(tmpDir, "unrelatedFile.jsonl"))
-	assert.NoError(err)
-
-	data, err := json.Marshal(datum3)
-	assert.NoError(err)
-
-	_, err = f.WriteString(string(data) + "\n")
-	assert.NoError(err)
-
-	f.Close()
-
-	// Call loadResumable
-	res, err := loadResumable("cmd", filepath.Join(tmpDir, "testFile.jsonl"))
-	assert.NoError(err)
-	assert.Equal([]datum{datum1, datum2}, res)
-
-	// Remove the resumable files
-	for i := 0; i < 2; i++ {
-		os.Remove(filepath.Join(tmpDir, "testFile_"+strconv.Itoa(i)+".jsonl"))
-	}
-
-	// Case when no resumable files are found
-	res, err = loadResumable("cmd", filepath.Join(tmpDir, "testFile.jsonl"))
-	assert.NoError(err)
-	if res == nil {
-		assert.Nil(res)
-	} else {
-		assert.Equal([]datum{}, res)
-	}
-}
-
 func TestLoadWordlist(t *testing.T) {
 	// Create a temporary file
 	tmpfile, err := os.CreateTemp("", "example")
@@ -7,96 +7,123 @@ import (
 	"strings"
 )
 
-type filterFn func(string) bool
+// filterFn returns the filter entry that matches a string, if any.
+type filterFn func(string) (string, bool)
 
 func cmdFilter(c *cmdCtx) error {
-	if c.c.IsSet("wordlist") && c.c.IsSet("string") {
-		return errors.New("cannot use both --wordlist and --string")
+	s, err := newFilterStage(c, c.c)
+	if err != nil {
+		return err
 	}
 
-	if !c.c.IsSet("wordlist") && !c.c.IsSet("string") {
-		return errors.New("must specify either --wordlist or --string")
+	in, out, err := stream(c, s.apply)
+	if err != nil {
+		return fmt.Errorf("failed to filter data: %w", err)
+	}
+
+	c.logger = c.logger.With().Int("in_record_count", in).Logger()
+	c.logger = c.logger.With().Int("filtered_count", out).Logger()
+	c.logger = c.logger.With().Int("filter_hits", in-out).Logger()
+
+	c.logger.Info().Msg("filtered data")
+
+	return nil
+}
+
+type filterStage struct {
+	c      *cmdCtx
+	fields []string
+	match  filterFn
+}
+
+func newFilterStage(c *cmdCtx, o options) (*filterStage, error) {
+	if o.IsSet("wordlist") && o.IsSet("string") {
+		return nil, errors.New("cannot use both --wordlist and --string")
+	}
+
+	if !o.IsSet("wordlist") && !o.IsSet("string") {
+		return nil, errors.New("must specify either --wordlist or --string")
 	}
 
 	var filterList []string
 	var match filterFn
 	var err error
 
-	if c.c.IsSet("wordlist") {
-		filterList, err = loadWordlist(c.c.String("wordlist"))
+	if o.IsSet("wordlist") {
+		filterList, err = loadWordlist(o.String("wordlist"))
 		if err != nil {
-			return fmt.Errorf("failed to load wordlist: %w", err)
+			return nil, fmt.Errorf("failed to load wordlist: %w", err)
 		}
 	} else {
-		filterList = []string{c.c.String("string")}
+		filterList = []string{o.String("string")}
+	}
+
+	// An empty entry would match everything.
+	var entries []string
+	for _, f := range filterList {
+		if f != "" {
+			entries = append(entries, f)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no non-empty filter entries")
 	}
+	filterList = entries
 
-	if c.c.Bool("regex") {
+	if o.Bool("regex") {
 		match, err = filterRegex(filterList)
 		if err != nil {
-			return fmt.Errorf("failed to compile regexp: %w", err)
+			return nil, fmt.Errorf("failed to compile regexp: %w", err)
 		}
 	} else {
 		match = filterStr(filterList)
 	}
 
-	var filtered []datum
-	extracted := extractFields(c)
-
-	for i, e := range extracted {
-		if !match(e) {
-			filtered = append(filtered, c.data[i])
-			continue
-		}
-		switch {
-		// This is a bug in urfave
-		// https://github.com/urfave/cli/issues/1737
-		case c.c.Count("debug") == 2:
-			c.logger.Debug().
-				Int("line", i+1).
-				Msg("filtered data")
-		case c.c.Count("debug") >= 3:
-			c.logger.Debug().
-				Int("line", i+1).
-				Interface("data", c.data[i]).
-				Msg("duplicate found")
-		}
-		continue
-	}
-
-	c.logger = c.logger.With().Int("filtered_count", len(filtered)).Logger()
-	c.logger = c.logger.With().Int("filter_hits", len(c.data)-len(filtered)).Logger()
-
-	c.logger.Info().Msg("filtered data")
-
-	c.logger.Info().Msg("writing data")
-
-	return write(c.outPath, filtered)
+	return &filterStage{
+		c:      c,
+		fields: o.StringSlice("fields"),
+		match:  match,
+	}, nil
 }
 
-func extractFields(c *cmdCtx) []string {
-	fields := c.c.StringSlice("fields")
-	var ret []string
-	for _, d := range c.data {
-		ret = append(ret, d.String(fields, false))
+func (s *filterStage) apply(line int, d datum) (string, error) {
+	entry, ok := s.match(d.String(s.fields, false))
+	if !ok {
+		return "", nil
 	}
-	return ret
+	switch {
+	// This is a bug in urfave
+	// https://github.com/urfave/cli/issues/1737
+	case s.c.c.Count("debug") == 2:
+		s.c.logger.Debug().
+			Int("line", line).
+			Msg("filtered data")
+	case s.c.c.Count("debug") >= 3:
+		s.c.logger.Debug().
+			Int("line", line).
+			Interface("data", d).
+			Msg("filtered data")
+	}
+	return fmt.Sprintf("match: %q", entry), nil
 }
 
 func filterStr(filters []string) filterFn {
-	return func(s string) bool {
+	return func(s string) (string, bool) {
 		for _, f := range filters {
-			if strings.Contains(s, f) {
-				return true
+			if f != "" && strings.Contains(s, f) {
+				return f, true
 			}
 		}
-		return false
+		return "", false
 	}
 }
 
 func filterRegex(filters []string) (filterFn, error) {
 	var rFilters []*regexp.Regexp
 	for _, f := range filters {
+		if f == "" {
+			continue
+		}
 		r, err := regexp.Compile(f)
 		if err != nil {
 			return nil, err
@@ -104,12 +131,12 @@ func filterRegex(filters []string) (filterFn, error) {
 		rFilters = append(rFilters, r)
 	}
 
-	return func(s string) bool {
+	return func(s string) (string, bool) {
 		for _, f := range rFilters {
 			if f.MatchString(s) {
-				return true
+				return f.String(), true
 			}
 		}
-		return false
+		return "", false
 	}, nil
 }
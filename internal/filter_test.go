@@ -1,67 +1,20 @@
 package internal
 
 import (
-	"flag"
 	"testing"
 
-	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
-	"github.com/urfave/cli/v2"
 )
 
-func TestExtractField(t *testing.T) {
-	t.Run("normal case", func(t *testing.T) {
-		set := flag.NewFlagSet("test", 0)
-		set.Var(cli.NewStringSlice("field1", "field3"), "fields", "doc")
-		c := &cmdCtx{
-			c: cli.NewContext(nil, set, nil),
-			data: []datum{
-				{"field1": "value1", "field2": "value2"},
-				{"field1": "value3", "field2": "value4", "field3": "value5"},
-			},
-			logger: zerolog.Nop(),
-		}
-		res := extractFields(c)
-		assert.Equal(t, []string{"value1\n", "value3\nvalue5\n"}, res)
-	})
-
-	t.Run("field not exist", func(t *testing.T) {
-		set := flag.NewFlagSet("test", 0)
-		set.Var(cli.NewStringSlice("field1", "field3"), "fields", "doc")
-		c := &cmdCtx{
-			c: cli.NewContext(nil, set, nil),
-			data: []datum{
-				{"field1": "value1", "field2": "value2"},
-				{"field1": "value3", "field2": "value4"},
-			},
-			logger: zerolog.Nop(),
-		}
-		res := extractFields(c)
-		assert.Equal(t, []string{"value1\n", "value3\n"}, res)
-	})
-
-	t.Run("empty data", func(t *testing.T) {
-		set := flag.NewFlagSet("test", 0)
-		set.Var(cli.NewStringSlice("field1"), "fields", "doc")
-		c := &cmdCtx{
-			c:      cli.NewContext(nil, set, nil),
-			data:   []datum{},
-			logger: zerolog.Nop(),
-		}
-		res := extractFields(c)
-		assert.Empty(t, res)
-	})
-}
-
 func TestFilterRegex(t *testing.T) {
 	t.Run("valid regex", func(t *testing.T) {
 		filters := []string{"abc", "123"}
 		filterFn, err := filterRegex(filters)
 		assert.NoError(t, err)
 
-		assert.True(t, filterFn("abcdef"))
-		assert.True(t, filterFn("987123"))
-		assert.False(t, filterFn("xyz987"))
+		assertMatch(t, filterFn, "abcdef", true)
+		assertMatch(t, filterFn, "987123", true)
+		assertMatch(t, filterFn, "xyz987", false)
 	})
 
 	t.Run("invalid regex", func(t *testing.T) {
@@ -75,7 +28,7 @@ func TestFilterRegex(t *testing.T) {
 		filterFn, err := filterRegex(filters)
 		assert.NoError(t, err)
 
-		assert.False(t, filterFn("xyz987"))
+		assertMatch(t, filterFn, "xyz987", false)
 	})
 
 	t.Run("empty filters", func(t *testing.T) {
@@ -83,7 +36,15 @@ func TestFilterRegex(t *testing.T) {
 		filterFn, err := filterRegex(filters)
 		assert.NoError(t, err)
 
-		assert.False(t, filterFn("xyz987"))
+		assertMatch(t, filterFn, "xyz987", false)
+	})
+
+	t.Run("empty entry", func(t *testing.T) {
+		filterFn, err := filterRegex([]string{"", "abc"})
+		assert.NoError(t, err)
+
+		assertMatch(t, filterFn, "xyz987", false)
+		assertMatch(t, filterFn, "abcdef", true)
 	})
 }
 
@@ -92,22 +53,52 @@ func TestFilterStr(t *testing.T) {
 		filters := []string{"abc", "123"}
 		filterFn := filterStr(filters)
 
-		assert.True(t, filterFn("abcdef"))
-		assert.True(t, filterFn("987123"))
-		assert.False(t, filterFn("xyz987"))
+		assertMatch(t, filterFn, "abcdef", true)
+		assertMatch(t, filterFn, "987123", true)
+		assertMatch(t, filterFn, "xyz987", false)
 	})
 
 	t.Run("no match", func(t *testing.T) {
 		filters := []string{"abc", "123"}
 		filterFn := filterStr(filters)
 
-		assert.False(t, filterFn("xyz987"))
+		assertMatch(t, filterFn, "xyz987", false)
 	})
 
 	t.Run("empty filters", func(t *testing.T) {
 		var filters []string
 		filterFn := filterStr(filters)
 
-		assert.False(t, filterFn("xyz987"))
+		assertMatch(t, filterFn, "xyz987", false)
+	})
+
+	t.Run("empty entry", func(t *testing.T) {
+		filterFn := filterStr([]string{"", "abc"})
+
+		assertMatch(t, filterFn, "xyz987", false)
+		assertMatch(t, filterFn, "abcdef", true)
+	})
+}
+
+func assertMatch(t *testing.T, fn filterFn, s string, expected bool) {
+	t.Helper()
+	_, ok := fn(s)
+	assert.Equal(t, expected, ok)
+}
+
+func TestFilterEntry(t *testing.T) {
+	t.Run("string returns matching entry", func(t *testing.T) {
+		entry, ok := filterStr([]string{"abc", "123"})("987123")
+		assert.True(t, ok)
+		assert.Equal(t, "123", entry)
+	})
+
+	t.Run("regex returns matching entry", func(t *testing.T) {
+		filterFn, err := filterRegex([]string{"a.c", "1[0-9]3"})
+		assert.NoError(t, err)
+
+		entry, ok := filterFn("987123")
+		assert.True(t, ok)
+		assert.Equal(t, "1[0-9]3", entry)
 	})
 }
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// reservedLabels are psort output files that aren't label buckets.
+var reservedLabels = []string{"checkpoint", "errors", "review", "unmatched"}
+
+// responseLabeler picks the label a psort response is sorted by.  By default
+// the label is the first rune of the response that isn't a space or
+// punctuation.  With --json-schema the response is parsed as a JSON object
+// and the value of --label-key is used, and with --label-regex the first
+// capture group, or the whole match, is used.  If --labels is set, the result
+// must be one of them, ignoring case, surrounding punctuation and spacing.
+type responseLabeler struct {
+	labels  map[string]bool
+	re      *regexp.Regexp
+	jsonKey string
+}
+
+func newResponseLabeler(labels []string, labelRegex string, jsonKey string) (*responseLabeler, error) {
+	l := &responseLabeler{jsonKey: jsonKey}
+
+	if labelRegex != "" {
+		re, err := regexp.Compile(labelRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label regex: %w", err)
+		}
+		l.re = re
+	}
+
+	if len(labels) > 0 {
+		l.labels = make(map[string]bool)
+		for _, label := range labels {
+			norm := normalizeLabel(label)
+			if norm == "" {
+				return nil, errors.New("empty label")
+			}
+			if isReservedLabel(norm) {
+				return nil, fmt.Errorf("label %q is reserved", label)
+			}
+			l.labels[norm] = true
+		}
+	}
+
+	return l, nil
+}
+
+// label returns the label for resp, or false if resp doesn't match.
+func (l *responseLabeler) label(resp string) (string, bool) {
+	s := resp
+
+	if l.jsonKey != "" {
+		v, ok := jsonValue(s, l.jsonKey)
+		if !ok {
+			return "", false
+		}
+		s = v
+	}
+
+	if l.re != nil {
+		m := l.re.FindStringSubmatch(s)
+		if m == nil {
+			return "", false
+		}
+		s = m[0]
+		if len(m) > 1 {
+			s = m[1]
+		}
+	}
+
+	if l.labels != nil {
+		label := normalizeLabel(s)
+		return label, l.labels[label]
+	}
+
+	if l.re != nil || l.jsonKey != "" {
+		s = strings.TrimSpace(s)
+		return s, s != "" && !isReservedLabel(s)
+	}
+
+	for _, r := range s {
+		if !unicode.IsSpace(r) && !unicode.IsPunct(r) {
+			return string(r), true
+		}
+	}
+
+	return "", false
+}
+
+// normalizeLabel lowercases s, trims surrounding spaces and punctuation, and
+// collapses runs of spaces, so "No." and " no" match, but "N/A" is "n/a".
+func normalizeLabel(s string) string {
+	s = strings.TrimFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	})
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// jsonValue parses the first JSON object in resp, which may be wrapped in
+// text or a code fence, and returns the value of key as a string.
+func jsonValue(resp string, key string) (string, bool) {
+	start := strings.Index(resp, "{")
+	end := strings.LastIndex(resp, "}")
+	if start < 0 || end < start {
+		return "", false
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(resp[start:end+1]), &obj); err != nil {
+		return "", false
+	}
+
+	switch v := obj[key].(type) {
+	case string:
+		return v, true
+	case float64, bool:
+		return fmt.Sprint(v), true
+	default:
+		return "", false
+	}
+}
+
+func isReservedLabel(s string) bool {
+	for _, r := range reservedLabels {
+		if strings.EqualFold(s, r) {
+			return true
+		}
+	}
+	return false
+}
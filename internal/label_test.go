@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseLabeler(t *testing.T) {
+	tests := []struct {
+		name      string
+		labels    []string
+		regex     string
+		jsonKey   string
+		resp      string
+		wantLabel string
+		wantOK    bool
+	}{
+		{name: "first rune", resp: "  'yes'", wantLabel: "y", wantOK: true},
+		{name: "first rune of number", resp: "10", wantLabel: "1", wantOK: true},
+		{name: "first rune empty", resp: " ...", wantOK: false},
+		{name: "labels match", labels: []string{"yes", "no", "unsure"}, resp: " No.", wantLabel: "no", wantOK: true},
+		{name: "labels case", labels: []string{"Yes"}, resp: "YES", wantLabel: "yes", wantOK: true},
+		{name: "labels multi-word", labels: []string{"not sure"}, resp: "Not  sure!", wantLabel: "not sure", wantOK: true},
+		{name: "labels whole response", labels: []string{"no"}, resp: "N/A", wantOK: false},
+		{name: "labels n/a", labels: []string{"no", "n/a"}, resp: "N/A", wantLabel: "n/a", wantOK: true},
+		{name: "labels no match", labels: []string{"yes", "no"}, resp: "maybe", wantOK: false},
+		{name: "regex group", regex: `Answer: (\w+)`, resp: "Thinking... Answer: Yes", wantLabel: "Yes", wantOK: true},
+		{name: "regex whole match", regex: `\d+`, resp: "I'd say 10 out of 10", wantLabel: "10", wantOK: true},
+		{name: "regex no match", regex: `\d+`, resp: "ten", wantOK: false},
+		{name: "regex and labels", labels: []string{"yes", "no"}, regex: `Answer: (\w+)`, resp: "Answer: NO", wantLabel: "no", wantOK: true},
+		{name: "regex reserved", regex: `\w+`, resp: "errors", wantOK: false},
+		{name: "json", jsonKey: "label", resp: `{"label": "spam", "reason": "ads"}`, wantLabel: "spam", wantOK: true},
+		{name: "json fenced", jsonKey: "label", resp: "```json\n{\"label\": \"ham\"}\n```", wantLabel: "ham", wantOK: true},
+		{name: "json number", jsonKey: "score", resp: `{"score": 10}`, wantLabel: "10", wantOK: true},
+		{name: "json missing key", jsonKey: "label", resp: `{"other": "x"}`, wantOK: false},
+		{name: "json invalid", jsonKey: "label", resp: `label: spam`, wantOK: false},
+		{name: "json and labels", labels: []string{"spam", "ham"}, jsonKey: "label", resp: `{"label": "Spam"}`, wantLabel: "spam", wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newResponseLabeler(tt.labels, tt.regex, tt.jsonKey)
+			require.NoError(t, err)
+
+			label, ok := l.label(tt.resp)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.wantLabel, label)
+			}
+		})
+	}
+}
+
+func TestNewResponseLabelerErrors(t *testing.T) {
+	_, err := newResponseLabeler(nil, "(", "")
+	assert.Error(t, err)
+
+	_, err = newResponseLabeler([]string{"yes", "..."}, "", "")
+	assert.Error(t, err)
+
+	_, err = newResponseLabeler([]string{"yes", "Unmatched"}, "", "")
+	assert.Error(t, err)
+}
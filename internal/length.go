@@ -3,71 +3,133 @@ package internal
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/reactorsh/ambrosia/tokenizer"
 )
 
 func cmdFilterLen(c *cmdCtx) error {
-	fields := c.c.StringSlice("fields")
+	s, err := newLengthStage(c, c.c)
+	if err != nil {
+		return err
+	}
 
-	if !c.c.IsSet("min") && !c.c.IsSet("max") {
-		return fmt.Errorf("at least one of --min and --max must be set")
+	in, out, err := stream(c, s.apply)
+	if err != nil {
+		return fmt.Errorf("failed to filter by length: %w", err)
 	}
 
-	var minLen *int
-	var maxLen *int
+	c.logger = c.logger.With().Int("in_record_count", in).Logger()
+	c.logger = c.logger.With().Int("filtered_count", out).Logger()
+	c.logger = c.logger.With().Int("out_of_bounds", in-out).Logger()
+	c.logger.Info().Msg("finished filtering by length")
 
-	if c.c.IsSet("min") {
-		min := c.c.Int("min")
-		minLen = &min
-	}
+	return nil
+}
 
-	if c.c.IsSet("max") {
-		max := c.c.Int("max")
-		maxLen = &max
-	}
+type lengthStage struct {
+	c       *cmdCtx
+	fields  []string
+	measure measureFn
+	minLen  *int
+	maxLen  *int
+}
 
-	var filtered []datum
+// measureFn returns the length of a string in some unit.
+type measureFn func(string) int
 
-	for i, d := range c.data {
-		dataLen := calculateStringLength(d, fields...)
+// newMeasureFn returns the measureFn for a --unit, loading the --tokenizer
+// file for tokens.
+func newMeasureFn(o options) (measureFn, error) {
+	unit := o.String("unit")
+	if unit != "tokens" && o.IsSet("tokenizer") {
+		return nil, fmt.Errorf("--tokenizer requires --unit tokens")
+	}
 
-		if minLen != nil && dataLen <= *minLen {
-			c.logger.Debug().
-				Int("line", i+1).
-				Int("length", dataLen).
-				Strs("fields", fields).
-				Msg("filtered by min length")
-			continue
+	switch unit {
+	case "", "bytes":
+		return func(s string) int { return len(s) }, nil
+	case "runes":
+		return utf8.RuneCountInString, nil
+	case "words":
+		return func(s string) int { return len(strings.Fields(s)) }, nil
+	case "tokens":
+		if o.String("tokenizer") == "" {
+			return nil, fmt.Errorf("--unit tokens requires --tokenizer")
 		}
-		if maxLen != nil && dataLen >= *maxLen {
-			c.logger.Debug().
-				Int("line", i+1).
-				Int("length", dataLen).
-				Strs("fields", fields).
-				Msg("filtered by max length")
-			continue
+		t, err := tokenizer.Load(o.String("tokenizer"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tokenizer: %w", err)
 		}
-
-		filtered = append(filtered, d)
+		return t.Count, nil
+	default:
+		return nil, fmt.Errorf("unknown unit %q, must be bytes, runes, words or tokens", unit)
 	}
+}
 
-	c.logger = c.logger.With().Int("filtered_count", len(filtered)).Logger()
-	c.logger = c.logger.With().Int("out_of_bounds", len(c.data)-len(filtered)).Logger()
-	c.logger.Info().Msg("finished filtering by length")
+func newLengthStage(c *cmdCtx, o options) (*lengthStage, error) {
+	if !o.IsSet("min") && !o.IsSet("max") {
+		return nil, fmt.Errorf("at least one of --min and --max must be set")
+	}
 
-	c.logger.Info().Msg("writing output")
-	err := write(c.outPath, filtered)
+	measure, err := newMeasureFn(o)
 	if err != nil {
-		return fmt.Errorf("failed to write output: %w", err)
+		return nil, err
 	}
 
-	return nil
+	s := &lengthStage{
+		c:       c,
+		fields:  o.StringSlice("fields"),
+		measure: measure,
+	}
+
+	if o.IsSet("min") {
+		min := o.Int("min")
+		s.minLen = &min
+	}
+
+	if o.IsSet("max") {
+		max := o.Int("max")
+		s.maxLen = &max
+	}
+
+	return s, nil
+}
+
+func (s *lengthStage) apply(line int, d datum) (string, error) {
+	dataLen := calculateLength(d, s.measure, s.fields...)
+
+	if s.minLen != nil && dataLen <= *s.minLen {
+		s.c.logger.Debug().
+			Int("line", line).
+			Int("length", dataLen).
+			Strs("fields", s.fields).
+			Msg("filtered by min length")
+		return "min_length", nil
+	}
+	if s.maxLen != nil && dataLen >= *s.maxLen {
+		s.c.logger.Debug().
+			Int("line", line).
+			Int("length", dataLen).
+			Strs("fields", s.fields).
+			Msg("filtered by max length")
+		return "max_length", nil
+	}
+
+	return "", nil
 }
 
 func calculateStringLength(m map[string]interface{}, keys ...string) int {
+	return calculateLength(m, func(s string) int { return len(s) }, keys...)
+}
+
+// calculateLength sums the length of each key, as measured by measure.
+func calculateLength(m map[string]interface{}, measure measureFn, keys ...string) int {
 	length := 0
 	for _, key := range keys {
 		if value, ok := m[key]; ok {
-			length += len(valueToString(value))
+			length += measure(valueToString(value))
 		}
 	}
 	return length
@@ -1,8 +1,11 @@
 package internal
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -72,3 +75,76 @@ func TestCalculateStringLength(t *testing.T) {
 		assert.Equal(t, 0, calculateStringLength(m))
 	})
 }
+
+func TestLengthStage(t *testing.T) {
+	o := stageOptions{"fields": "text", "min": 2, "max": 5}
+	s, err := newLengthStage(&cmdCtx{logger: zerolog.Nop()}, o)
+	assert.NoError(t, err)
+
+	reason, err := s.apply(1, datum{"text": "ab"})
+	assert.NoError(t, err)
+	assert.Equal(t, "min_length", reason)
+
+	reason, err = s.apply(2, datum{"text": "abcde"})
+	assert.NoError(t, err)
+	assert.Equal(t, "max_length", reason)
+
+	reason, err = s.apply(3, datum{"text": "abc"})
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	_, err = newLengthStage(&cmdCtx{logger: zerolog.Nop()}, stageOptions{"fields": "text"})
+	assert.Error(t, err)
+}
+
+func TestLengthUnits(t *testing.T) {
+	d := datum{"text": "héllo  wörld"}
+
+	tests := []struct {
+		unit string
+		want int
+	}{
+		{"", 14},
+		{"bytes", 14},
+		{"runes", 12},
+		{"words", 2},
+	}
+
+	for _, tt := range tests {
+		measure, err := newMeasureFn(stageOptions{"unit": tt.unit})
+		assert.NoError(t, err, tt.unit)
+		assert.Equal(t, tt.want, calculateLength(d, measure, "text"), tt.unit)
+	}
+
+	_, err := newMeasureFn(stageOptions{"unit": "lines"})
+	assert.Error(t, err)
+
+	_, err = newMeasureFn(stageOptions{"unit": "tokens"})
+	assert.Error(t, err, "tokens without a tokenizer")
+
+	_, err = newMeasureFn(stageOptions{"unit": "words", "tokenizer": "x.json"})
+	assert.Error(t, err, "tokenizer without tokens")
+}
+
+func TestLengthTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokenizer.json")
+	js := `{
+		"pre_tokenizer": {"type": "ByteLevel"},
+		"decoder": {"type": "ByteLevel"},
+		"model": {"type": "BPE", "merges": ["h e", "l l", "he ll", "hell o"]}
+	}`
+	assert.NoError(t, os.WriteFile(path, []byte(js), 0644))
+
+	o := stageOptions{"fields": "text", "unit": "tokens", "tokenizer": path, "max": 3}
+	s, err := newLengthStage(&cmdCtx{logger: zerolog.Nop()}, o)
+	assert.NoError(t, err)
+
+	// One token, although 5 bytes.
+	reason, err := s.apply(1, datum{"text": "hello"})
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	reason, err = s.apply(2, datum{"text": "hello hello"})
+	assert.NoError(t, err)
+	assert.Equal(t, "max_length", reason)
+}
@@ -0,0 +1,232 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"math/rand"
+	"strings"
+)
+
+const (
+	defaultShingleSize = 3
+	defaultPermCount   = 128
+	defaultBandCount   = 16
+	defaultMHThreshold = 0.7
+	defaultRLThreshold = 0.7
+
+	// mersennePrime is 2^61-1, the modulus for the permutation hashes.
+	mersennePrime = (1 << 61) - 1
+
+	// minhashSeed is fixed so signatures are the same between runs.
+	minhashSeed = 0x616d62726f736961
+)
+
+// minhashStage drops near-duplicates using MinHash signatures of word
+// shingles, with locality-sensitive hashing to find candidate pairs.  Each
+// datum is only compared against the earlier data it shares a band with, so
+// this scales to far more data than dedupeRL.  The first datum of each group
+// of near-duplicates is kept.
+//
+// If confirmRL is set, candidates must also have a ROUGE-L score above
+// rlThreshold to be treated as duplicates.
+type minhashStage struct {
+	c           *cmdCtx
+	fields      []string
+	shingleSize int
+	rows        int
+	threshold   float64
+	confirmRL   bool
+	rlThreshold float64
+
+	permA []uint64
+	permB []uint64
+
+	// buckets maps the hash of each band to indexes in kept.
+	buckets []map[uint64][]int
+	kept    []minhashEntry
+}
+
+type minhashEntry struct {
+	line   int
+	sig    []uint64
+	tokens []string
+}
+
+func newMinhashStage(c *cmdCtx, o options) (*minhashStage, error) {
+	shingleSize := intOr(o, "mh-shingle", defaultShingleSize)
+	permCount := intOr(o, "mh-perms", defaultPermCount)
+	bandCount := intOr(o, "mh-bands", defaultBandCount)
+	threshold := float64Or(o, "mh-threshold", defaultMHThreshold)
+
+	switch {
+	case shingleSize < 1:
+		return nil, errors.New("shingle size must be at least 1")
+	case permCount < 1 || bandCount < 1:
+		return nil, errors.New("permutations and bands must be at least 1")
+	case permCount%bandCount != 0:
+		return nil, fmt.Errorf("permutations (%d) must be divisible by bands (%d)", permCount, bandCount)
+	case threshold < 0 || threshold > 1:
+		return nil, errors.New("minhash threshold must be between 0 and 1")
+	}
+
+	s := &minhashStage{
+		c:           c,
+		fields:      o.StringSlice("fields"),
+		shingleSize: shingleSize,
+		rows:        permCount / bandCount,
+		threshold:   threshold,
+		confirmRL:   o.Bool("rougel"),
+		rlThreshold: float64Or(o, "rl-threshold", defaultRLThreshold),
+		permA:       make([]uint64, permCount),
+		permB:       make([]uint64, permCount),
+		buckets:     make([]map[uint64][]int, bandCount),
+	}
+
+	rng := rand.New(rand.NewSource(minhashSeed))
+	for i := 0; i < permCount; i++ {
+		s.permA[i] = uint64(rng.Int63n(mersennePrime-1)) + 1
+		s.permB[i] = uint64(rng.Int63n(mersennePrime))
+	}
+
+	for i := range s.buckets {
+		s.buckets[i] = make(map[uint64][]int)
+	}
+
+	return s, nil
+}
+
+func (s *minhashStage) apply(line int, d datum) (string, error) {
+	tokens := strings.Fields(strings.ToLower(d.String(s.fields, true)))
+	if len(tokens) == 0 {
+		s.c.logger.Debug().
+			Int("line", line).
+			Msg("empty field, not comparing")
+		return "", nil
+	}
+
+	sig := s.signature(tokens)
+	bandKeys := make([]uint64, len(s.buckets))
+	for i := range s.buckets {
+		bandKeys[i] = hashBand(sig[i*s.rows : (i+1)*s.rows])
+	}
+
+	checked := make(map[int]struct{})
+	for i, key := range bandKeys {
+		for _, idx := range s.buckets[i][key] {
+			if _, ok := checked[idx]; ok {
+				continue
+			}
+			checked[idx] = struct{}{}
+
+			cand := s.kept[idx]
+			jaccard := estimateJaccard(sig, cand.sig)
+			if jaccard < s.threshold {
+				continue
+			}
+
+			reason := fmt.Sprintf("duplicate_of: %d, jaccard: %.2f", cand.line, jaccard)
+			if s.confirmRL {
+				rl := rougeL(tokens, cand.tokens)
+				if rl <= s.rlThreshold {
+					continue
+				}
+				reason = fmt.Sprintf("%s, rougel: %.2f", reason, rl)
+			}
+
+			s.c.logger.Debug().
+				Int("line", line).
+				Int("duplicate_of", cand.line).
+				Float64("jaccard", jaccard).
+				Msg("duplicate found")
+			return reason, nil
+		}
+	}
+
+	entry := minhashEntry{line: line, sig: sig}
+	if s.confirmRL {
+		entry.tokens = tokens
+	}
+	s.kept = append(s.kept, entry)
+
+	idx := len(s.kept) - 1
+	for i, key := range bandKeys {
+		s.buckets[i][key] = append(s.buckets[i][key], idx)
+	}
+
+	return "", nil
+}
+
+// signature returns the MinHash signature of the word shingles in tokens.
+// Data shorter than a shingle is treated as a single shingle.
+func (s *minhashStage) signature(tokens []string) []uint64 {
+	sig := make([]uint64, len(s.permA))
+	for i := range sig {
+		sig[i] = mersennePrime
+	}
+
+	n := len(tokens) - s.shingleSize + 1
+	if n < 1 {
+		n = 1
+	}
+
+	for i := 0; i < n; i++ {
+		end := i + s.shingleSize
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+
+		h := hashShingle(tokens[i:end])
+		for j := range sig {
+			if p := permute(s.permA[j], s.permB[j], h); p < sig[j] {
+				sig[j] = p
+			}
+		}
+	}
+
+	return sig
+}
+
+func hashShingle(tokens []string) uint64 {
+	return hashNgram(tokens) % mersennePrime
+}
+
+func hashBand(rows []uint64) uint64 {
+	h := fnv.New64a()
+	var b [8]byte
+	for _, r := range rows {
+		for i := range b {
+			b[i] = byte(r >> (8 * i))
+		}
+		h.Write(b[:])
+	}
+	return h.Sum64()
+}
+
+// permute returns (a*x + b) mod 2^61-1.  x, a and b must be less than the
+// modulus.
+func permute(a, b, x uint64) uint64 {
+	hi, lo := bits.Mul64(a, x)
+
+	// 2^64 = 8 (mod 2^61-1), so hi*2^64 + lo = hi*8 + lo.
+	r := (lo & mersennePrime) + (lo >> 61) + (hi << 3)
+	r = (r & mersennePrime) + (r >> 61)
+	r += b
+	r = (r & mersennePrime) + (r >> 61)
+	if r >= mersennePrime {
+		r -= mersennePrime
+	}
+
+	return r
+}
+
+func estimateJaccard(a, b []uint64) float64 {
+	var same int
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(a))
+}
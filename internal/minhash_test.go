@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermute(t *testing.T) {
+	testCases := []struct {
+		a, b, x uint64
+	}{
+		{a: 1, b: 0, x: 5},
+		{a: 12345, b: 678, x: 91011},
+		{a: mersennePrime - 1, b: mersennePrime - 1, x: mersennePrime - 1},
+		{a: 1 << 60, b: 3, x: (1 << 60) + 7},
+	}
+
+	for _, tc := range testCases {
+		// Reference implementation using repeated doubling.
+		expected := uint64(0)
+		a, x := tc.a%mersennePrime, tc.x
+		for x > 0 {
+			if x&1 == 1 {
+				expected = (expected + a) % mersennePrime
+			}
+			a = (a * 2) % mersennePrime
+			x >>= 1
+		}
+		expected = (expected + tc.b) % mersennePrime
+
+		assert.Equal(t, expected, permute(tc.a, tc.b, tc.x))
+	}
+}
+
+func TestMinhashStage(t *testing.T) {
+	newStage := func(t *testing.T, o stageOptions) *minhashStage {
+		o["fields"] = "text"
+		s, err := newMinhashStage(&cmdCtx{logger: zerolog.Nop()}, o)
+		assert.NoError(t, err)
+		return s
+	}
+
+	t.Run("exact duplicates", func(t *testing.T) {
+		s := newStage(t, stageOptions{})
+		data := []datum{
+			{"text": "the quick brown fox jumps over the lazy dog"},
+			{"text": "The quick brown fox jumps over the lazy dog"},
+		}
+		assert.Equal(t, data[:1], applyRecordFn(t, s.apply, data))
+	})
+
+	t.Run("near duplicates", func(t *testing.T) {
+		s := newStage(t, stageOptions{"mh-shingle": 1})
+		data := []datum{
+			{"text": "the quick brown fox jumps over the lazy dog near the river bank today"},
+			{"text": "the quick brown fox jumps over the lazy dog near the river bank"},
+			{"text": "an entirely different sentence about something unrelated"},
+		}
+		res := applyRecordFn(t, s.apply, data)
+		assert.Equal(t, []datum{data[0], data[2]}, res)
+	})
+
+	t.Run("reason has line of kept datum", func(t *testing.T) {
+		s := newStage(t, stageOptions{})
+		_, err := s.apply(4, datum{"text": "some text to compare here"})
+		assert.NoError(t, err)
+		reason, err := s.apply(9, datum{"text": "some text to compare here"})
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(reason, "duplicate_of: 4, jaccard: 1.00"), reason)
+	})
+
+	t.Run("missing fields are not duplicates", func(t *testing.T) {
+		s := newStage(t, stageOptions{})
+		data := []datum{{"other": "x"}, {"other": "y"}}
+		assert.Equal(t, data, applyRecordFn(t, s.apply, data))
+	})
+
+	t.Run("confirm with rougel", func(t *testing.T) {
+		// Same words in a different order have identical unigram shingles,
+		// but a low ROUGE-L score.
+		data := []datum{
+			{"text": "one two three four five six"},
+			{"text": "six five four three two one"},
+		}
+
+		s := newStage(t, stageOptions{"mh-shingle": 1})
+		assert.Len(t, applyRecordFn(t, s.apply, data), 1)
+
+		s = newStage(t, stageOptions{"mh-shingle": 1, "rougel": true})
+		assert.Len(t, applyRecordFn(t, s.apply, data), 2)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		for _, o := range []stageOptions{
+			{"mh-perms": 100, "mh-bands": 16},
+			{"mh-shingle": 0},
+			{"mh-threshold": 1.5},
+			{"mh-bands": 0},
+		} {
+			_, err := newMinhashStage(&cmdCtx{logger: zerolog.Nop()}, o)
+			assert.Error(t, err)
+		}
+	})
+}
@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// options is the subset of *cli.Context used to configure a stage.  It lets
+// the same stage be configured from command line flags or from a recipe.
+type options interface {
+	IsSet(name string) bool
+	String(name string) string
+	StringSlice(name string) []string
+	Bool(name string) bool
+	Int(name string) int
+	Float64(name string) float64
+}
+
+// intOr returns the named option, or def if it isn't set.
+func intOr(o options, name string, def int) int {
+	if !o.IsSet(name) {
+		return def
+	}
+	return o.Int(name)
+}
+
+// float64Or returns the named option, or def if it isn't set.
+func float64Or(o options, name string, def float64) float64 {
+	if !o.IsSet(name) {
+		return def
+	}
+	return o.Float64(name)
+}
+
+// stageOptions holds the options for a single pipeline stage, as parsed from a
+// recipe file or a --stage flag.  They are checked by validate before a stage
+// is created, so the accessors below only see values of the right type.
+type stageOptions map[string]interface{}
+
+// optionKind is the type of value a stage option takes.
+type optionKind int
+
+const (
+	stringOpt optionKind = iota
+	stringSliceOpt
+	boolOpt
+	intOpt
+	float64Opt
+)
+
+// stageOption is an option a pipeline stage accepts, matching a flag of the
+// command the stage runs.
+type stageOption struct {
+	name    string
+	aliases []string
+	kind    optionKind
+}
+
+// validate checks o against the options a stage accepts.  It returns a copy
+// of o with aliases replaced by option names, and values converted to their
+// option's type.  Unknown options, and values that can't be converted, are
+// errors.
+func (o stageOptions) validate(accepted []stageOption) (stageOptions, error) {
+	byName := make(map[string]stageOption)
+	for _, opt := range accepted {
+		byName[opt.name] = opt
+		for _, a := range opt.aliases {
+			byName[a] = opt
+		}
+	}
+
+	ret := stageOptions{}
+	for key, v := range o {
+		if key == "stage" {
+			ret[key] = v
+			continue
+		}
+
+		opt, ok := byName[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown option %q", key)
+		}
+		if _, dup := ret[opt.name]; dup {
+			return nil, fmt.Errorf("option %q is set more than once", opt.name)
+		}
+
+		cv, err := convertOption(opt.kind, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for option %q: %w", opt.name, err)
+		}
+		ret[opt.name] = cv
+	}
+
+	return ret, nil
+}
+
+// convertOption converts v, as parsed from a flag or a recipe, to kind.
+func convertOption(kind optionKind, v interface{}) (interface{}, error) {
+	switch kind {
+	case stringOpt:
+		switch v.(type) {
+		case string, int, float64:
+			return valueToString(v), nil
+		}
+	case stringSliceOpt:
+		switch v := v.(type) {
+		case string:
+			return strings.Split(v, ","), nil
+		case []string:
+			return v, nil
+		case []interface{}:
+			ret := make([]string, 0, len(v))
+			for _, e := range v {
+				switch e.(type) {
+				case string, int, float64, bool:
+					ret = append(ret, valueToString(e))
+				default:
+					return nil, fmt.Errorf("%v is not a list of strings", v)
+				}
+			}
+			return ret, nil
+		}
+	case boolOpt:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a boolean", v)
+			}
+			return b, nil
+		}
+	case intOpt:
+		switch v := v.(type) {
+		case int:
+			return v, nil
+		case float64:
+			if v != float64(int(v)) {
+				return nil, fmt.Errorf("%v is not an integer", v)
+			}
+			return int(v), nil
+		case string:
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an integer", v)
+			}
+			return i, nil
+		}
+	case float64Opt:
+		switch v := v.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a number", v)
+			}
+			return f, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected value %v", v)
+}
+
+func (o stageOptions) IsSet(name string) bool {
+	_, ok := o[name]
+	return ok
+}
+
+func (o stageOptions) String(name string) string {
+	v, ok := o[name]
+	if !ok {
+		return ""
+	}
+	return valueToString(v)
+}
+
+func (o stageOptions) StringSlice(name string) []string {
+	switch v := o[name].(type) {
+	case []interface{}:
+		var ret []string
+		for _, e := range v {
+			ret = append(ret, valueToString(e))
+		}
+		return ret
+	case []string:
+		return v
+	case string:
+		return strings.Split(v, ",")
+	default:
+		return nil
+	}
+}
+
+func (o stageOptions) Bool(name string) bool {
+	switch v := o[name].(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	default:
+		return false
+	}
+}
+
+func (o stageOptions) Int(name string) int {
+	switch v := o[name].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	case string:
+		i, _ := strconv.Atoi(v)
+		return i
+	default:
+		return 0
+	}
+}
+
+func (o stageOptions) Float64(name string) float64 {
+	switch v := o[name].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	default:
+		return 0
+	}
+}
+
+// parseStageOptions parses a --stage flag value of the form
+// "NAME key=value key=value flag", e.g. "length fields=output min=10".
+// Options without a value are treated as boolean flags.
+func parseStageOptions(s string) (stageOptions, error) {
+	parts := strings.Fields(s)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty stage")
+	}
+
+	ret := stageOptions{"stage": parts[0]}
+	for _, p := range parts[1:] {
+		key, val, found := strings.Cut(p, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid option %q for stage %q", p, parts[0])
+		}
+		if !found {
+			ret[key] = true
+			continue
+		}
+		ret[key] = val
+	}
+
+	return ret, nil
+}
+
+// StageFlag collects repeated --stage flags.  Unlike a string slice flag, it
+// doesn't split values on commas, so stage options can hold lists.
+type StageFlag struct {
+	stages []string
+}
+
+func (f *StageFlag) Set(value string) error {
+	f.stages = append(f.stages, value)
+	return nil
+}
+
+func (f *StageFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(f.stages, "; ")
+}
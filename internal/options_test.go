@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStageOptions(t *testing.T) {
+	o := stageOptions{
+		"str":       "value",
+		"list":      []interface{}{"a", "b"},
+		"commaList": "a,b",
+		"bool":      true,
+		"boolStr":   "true",
+		"int":       10,
+		"float":     10.0,
+		"intStr":    "10",
+		"floatStr":  "0.5",
+	}
+
+	assert.True(t, o.IsSet("str"))
+	assert.False(t, o.IsSet("missing"))
+
+	assert.Equal(t, "value", o.String("str"))
+	assert.Equal(t, "", o.String("missing"))
+
+	assert.Equal(t, []string{"a", "b"}, o.StringSlice("list"))
+	assert.Equal(t, []string{"a", "b"}, o.StringSlice("commaList"))
+	assert.Nil(t, o.StringSlice("missing"))
+
+	assert.True(t, o.Bool("bool"))
+	assert.True(t, o.Bool("boolStr"))
+	assert.False(t, o.Bool("missing"))
+
+	assert.Equal(t, 10, o.Int("int"))
+	assert.Equal(t, 10, o.Int("float"))
+	assert.Equal(t, 10, o.Int("intStr"))
+	assert.Equal(t, 0, o.Int("missing"))
+
+	assert.Equal(t, 10.0, o.Float64("int"))
+	assert.Equal(t, 0.5, o.Float64("floatStr"))
+	assert.Equal(t, 0.0, o.Float64("missing"))
+}
+
+func TestStageOptionsValidate(t *testing.T) {
+	accepted := []stageOption{
+		{name: "fields", aliases: []string{"f"}, kind: stringSliceOpt},
+		{name: "ignore-case", aliases: []string{"i"}, kind: boolOpt},
+		{name: "min", kind: intOpt},
+		{name: "threshold", kind: float64Opt},
+		{name: "unit", kind: stringOpt},
+	}
+
+	t.Run("converts values and aliases", func(t *testing.T) {
+		o, err := stageOptions{
+			"stage":     "length",
+			"f":         []interface{}{"a", "b"},
+			"i":         "true",
+			"min":       10.0,
+			"threshold": "0.5",
+			"unit":      "tokens",
+		}.validate(accepted)
+		assert.NoError(t, err)
+		assert.Equal(t, stageOptions{
+			"stage":       "length",
+			"fields":      []string{"a", "b"},
+			"ignore-case": true,
+			"min":         10,
+			"threshold":   0.5,
+			"unit":        "tokens",
+		}, o)
+	})
+
+	for name, o := range map[string]stageOptions{
+		"unknown option":    {"colour": "red"},
+		"invalid int":       {"min": "abc"},
+		"fractional int":    {"min": 1.5},
+		"invalid bool":      {"ignore-case": "yes"},
+		"invalid float":     {"threshold": "high"},
+		"list for a string": {"unit": []interface{}{"a"}},
+		"alias and name":    {"i": true, "ignore-case": true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := o.validate(accepted)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseStageOptions(t *testing.T) {
+	t.Run("valid stage", func(t *testing.T) {
+		o, err := parseStageOptions("length fields=input,output min=10 ignore-case")
+		assert.NoError(t, err)
+		assert.Equal(t, stageOptions{
+			"stage":       "length",
+			"fields":      "input,output",
+			"min":         "10",
+			"ignore-case": true,
+		}, o)
+	})
+
+	t.Run("empty stage", func(t *testing.T) {
+		_, err := parseStageOptions("  ")
+		assert.Error(t, err)
+	})
+
+	t.Run("missing option name", func(t *testing.T) {
+		_, err := parseStageOptions("length =10")
+		assert.Error(t, err)
+	})
+}
+
+func TestStageFlag(t *testing.T) {
+	f := &StageFlag{}
+	assert.NoError(t, f.Set("whitespace fields=a,b"))
+	assert.NoError(t, f.Set("dedupe fields=a"))
+	assert.Equal(t, []string{"whitespace fields=a,b", "dedupe fields=a"}, f.stages)
+}
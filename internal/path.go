@@ -20,16 +20,18 @@ func genOutPath(cmd string, args []string) string {
 	return filepath.Join(dir, fmt.Sprintf("%s_%s%s", filename, cmd, ext))
 }
 
-func searchPrefix(infilePath string) string {
+func prefixPathTmpl(infilePath string) string {
 	infileBase := filepath.Base(infilePath)
 	infileExt := filepath.Ext(infileBase)
 	infileName := strings.TrimSuffix(infileBase, infileExt)
-	return fmt.Sprintf("%s_", infileName)
+	return filepath.Join(filepath.Dir(infilePath), fmt.Sprintf("%s_psort_%%s%s", infileName, infileExt))
 }
 
-func prefixPathTmpl(infilePath string) string {
+// psortPath returns the path of a psort output file that isn't a sorted
+// bucket, such as "<infile>_psort_errors.jsonl".
+func psortPath(infilePath, name string) string {
 	infileBase := filepath.Base(infilePath)
 	infileExt := filepath.Ext(infileBase)
 	infileName := strings.TrimSuffix(infileBase, infileExt)
-	return filepath.Join(filepath.Dir(infilePath), fmt.Sprintf("%s_psort_%%c%s", infileName, infileExt))
+	return filepath.Join(filepath.Dir(infilePath), fmt.Sprintf("%s_psort_%s%s", infileName, name, infileExt))
 }
@@ -24,31 +24,36 @@ func TestPrefixPathTmpl(t *testing.T) {
 
 	// Test Case 1: Regular file path
 	filePath := "/home/user/test.txt"
-	expected := "/home/user/test_psort_%c.txt"
+	expected := "/home/user/test_psort_%s.txt"
 	result := prefixPathTmpl(filePath)
 	assert.Equal(expected, result, "They should be equal")
 
 	// Test Case 2: File path without extension
 	filePath = "/home/user/test"
-	expected = "/home/user/test_psort_%c"
+	expected = "/home/user/test_psort_%s"
 	result = prefixPathTmpl(filePath)
 	assert.Equal(expected, result, "They should be equal")
 
 	// Test Case 3: File in root directory
 	filePath = "/test.txt"
-	expected = "/test_psort_%c.txt"
+	expected = "/test_psort_%s.txt"
 	result = prefixPathTmpl(filePath)
 	assert.Equal(expected, result, "They should be equal")
 
 	// Test Case 4: File path with spaces and special characters
 	filePath = "/home/user/test file@.txt"
-	expected = "/home/user/test file@_psort_%c.txt"
+	expected = "/home/user/test file@_psort_%s.txt"
 	result = prefixPathTmpl(filePath)
 	assert.Equal(expected, result, "They should be equal")
 
 	// Test Case 5: Empty file path
 	filePath = ""
-	expected = "_psort_%c."
+	expected = "_psort_%s."
 	result = prefixPathTmpl(filePath)
 	assert.Equal(expected, result, "They should be equal")
 }
+
+func TestPsortPath(t *testing.T) {
+	assert.Equal(t, "/home/user/test_psort_errors.jsonl", psortPath("/home/user/test.jsonl", "errors"))
+	assert.Equal(t, "test_psort_errors", psortPath("test", "errors"))
+}
@@ -0,0 +1,252 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// recipe is an ordered list of pipeline stages, loaded from a YAML or JSON
+// file.  Each stage names its command with the "stage" key; every other key
+// is an option for that command, e.g.:
+//
+//	stages:
+//	  - stage: whitespace
+//	    fields: [instruction, output]
+//	  - stage: length
+//	    fields: [output]
+//	    min: 10
+type recipe struct {
+	Stages []stageOptions `json:"stages" yaml:"stages"`
+}
+
+// stageOptionSets lists the options each pipeline stage accepts.  They match
+// the flags of the stage's command, less those that only make sense when the
+// command runs on its own.
+var stageOptionSets = map[string][]stageOption{
+	"whitespace": {
+		{name: "fields", aliases: []string{"f"}, kind: stringSliceOpt},
+	},
+	"length": {
+		{name: "fields", aliases: []string{"f"}, kind: stringSliceOpt},
+		{name: "min", kind: intOpt},
+		{name: "max", kind: intOpt},
+		{name: "unit", aliases: []string{"u"}, kind: stringOpt},
+		{name: "tokenizer", kind: stringOpt},
+	},
+	"filter": {
+		{name: "fields", aliases: []string{"f"}, kind: stringSliceOpt},
+		{name: "regex", aliases: []string{"r"}, kind: boolOpt},
+		{name: "wordlist", aliases: []string{"w"}, kind: stringOpt},
+		{name: "string", aliases: []string{"s"}, kind: stringOpt},
+	},
+	"dedupe": {
+		{name: "fields", aliases: []string{"f"}, kind: stringSliceOpt},
+		{name: "ignore-case", aliases: []string{"i"}, kind: boolOpt},
+		{name: "rougel", aliases: []string{"rl"}, kind: boolOpt},
+		{name: "rl-threshold", aliases: []string{"rlt"}, kind: float64Opt},
+		{name: "against", kind: stringSliceOpt},
+		{name: "against-fields", kind: stringSliceOpt},
+		{name: "minhash", aliases: []string{"mh"}, kind: boolOpt},
+		{name: "mh-shingle", kind: intOpt},
+		{name: "mh-perms", kind: intOpt},
+		{name: "mh-bands", kind: intOpt},
+		{name: "mh-threshold", kind: float64Opt},
+	},
+	"decontam": {
+		{name: "fields", aliases: []string{"f"}, kind: stringSliceOpt},
+		{name: "benchmarks", aliases: []string{"b"}, kind: stringSliceOpt},
+		{name: "benchmark-fields", kind: stringSliceOpt},
+		{name: "ngram", aliases: []string{"n"}, kind: intOpt},
+	},
+}
+
+type pipelineStage struct {
+	name string
+	fn   recordFn
+	in   int
+	out  int
+}
+
+func cmdPipeline(c *cmdCtx) error {
+	stageOpts, err := loadStageOptions(c)
+	if err != nil {
+		return err
+	}
+
+	var stages []*pipelineStage
+	for i, o := range stageOpts {
+		s, err := newPipelineStage(c, o)
+		if err != nil {
+			return fmt.Errorf("failed to create stage %d: %w", i+1, err)
+		}
+		stages = append(stages, s)
+	}
+
+	c.logger.Info().Int("stages", len(stages)).Msg("running pipeline")
+
+	in, out, err := stream(c, func(line int, d datum) (string, error) {
+		for _, s := range stages {
+			s.in++
+			reason, err := s.fn(line, d)
+			if err != nil {
+				return "", fmt.Errorf("stage %s: %w", s.name, err)
+			}
+			if reason != "" {
+				return s.name + ": " + reason, nil
+			}
+			s.out++
+		}
+		return "", nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to run pipeline: %w", err)
+	}
+
+	for i, s := range stages {
+		c.logger.Info().
+			Int("stage", i+1).
+			Str("name", s.name).
+			Int("in_record_count", s.in).
+			Int("out_record_count", s.out).
+			Int("dropped", s.in-s.out).
+			Msg("stage finished")
+	}
+
+	c.logger = c.logger.With().Int("in_record_count", in).Logger()
+	c.logger = c.logger.With().Int("out_record_count", out).Logger()
+	c.logger.Info().Msg("finished pipeline")
+
+	return nil
+}
+
+func newPipelineStage(c *cmdCtx, o stageOptions) (*pipelineStage, error) {
+	name := o.String("stage")
+	if name == "" {
+		return nil, errors.New("missing stage name")
+	}
+
+	accepted, ok := stageOptionSets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown stage %q", name)
+	}
+	o, err := o.validate(accepted)
+	if err != nil {
+		return nil, fmt.Errorf("stage %s: %w", name, err)
+	}
+
+	// Each stage gets its own logger so debug output can be attributed.
+	sc := *c
+	sc.logger = c.logger.With().Str("stage", name).Logger()
+
+	s := &pipelineStage{name: name}
+
+	switch name {
+	case "whitespace":
+		s.fn = newWhitespaceStage(&sc, o).apply
+	case "length":
+		ls, err := newLengthStage(&sc, o)
+		if err != nil {
+			return nil, err
+		}
+		s.fn = ls.apply
+	case "filter":
+		fs, err := newFilterStage(&sc, o)
+		if err != nil {
+			return nil, err
+		}
+		s.fn = fs.apply
+	case "dedupe":
+		switch {
+		case o.Bool("minhash"):
+			ms, err := newMinhashStage(&sc, o)
+			if err != nil {
+				return nil, err
+			}
+			s.fn = ms.apply
+		case o.Bool("rougel"):
+			return nil, errors.New("rougel dedupe is only supported in a pipeline with minhash")
+		default:
+			ds, err := newDedupeStage(&sc, o)
+			if err != nil {
+				return nil, err
+			}
+			s.fn = ds.apply
+		}
+	case "decontam":
+		ds, err := newDecontamStage(&sc, o)
+		if err != nil {
+			return nil, err
+		}
+		s.fn = ds.apply
+	}
+
+	if len(o.StringSlice("fields")) == 0 {
+		return nil, fmt.Errorf("stage %s: fields must be set", name)
+	}
+
+	return s, nil
+}
+
+// loadStageOptions returns the stages to run, either from --recipe or from
+// the --stage flags.
+func loadStageOptions(c *cmdCtx) ([]stageOptions, error) {
+	if c.c.IsSet("recipe") && c.c.IsSet("stage") {
+		return nil, errors.New("cannot use both --recipe and --stage")
+	}
+
+	if c.c.IsSet("recipe") {
+		r, err := loadRecipe(c.c.String("recipe"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load recipe: %w", err)
+		}
+		if len(r.Stages) == 0 {
+			return nil, errors.New("recipe has no stages")
+		}
+		return r.Stages, nil
+	}
+
+	if !c.c.IsSet("stage") {
+		return nil, errors.New("must specify either --recipe or --stage")
+	}
+
+	sf, ok := c.c.Generic("stage").(*StageFlag)
+	if !ok {
+		return nil, errors.New("invalid --stage flag")
+	}
+
+	var ret []stageOptions
+	for _, s := range sf.stages {
+		o, err := parseStageOptions(s)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, o)
+	}
+
+	return ret, nil
+}
+
+func loadRecipe(path string) (*recipe, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r recipe
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(b, &r)
+	} else {
+		err = yaml.Unmarshal(b, &r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestCmdPipeline(t *testing.T) {
+	data := []datum{
+		{"text": " hello "},
+		{"text": "hello"},
+		{"text": "hi"},
+		{"text": "a much longer piece of text"},
+	}
+
+	newCtx := func(t *testing.T, args ...string) *cmdCtx {
+		tempDir := t.TempDir()
+		inPath := filepath.Join(tempDir, "input.jsonl")
+		require.NoError(t, write(inPath, data))
+
+		set := flag.NewFlagSet("test", 0)
+		set.String("recipe", "", "doc")
+		set.Var(&StageFlag{}, "stage", "doc")
+		require.NoError(t, set.Parse(args))
+
+		return &cmdCtx{
+			c:       cli.NewContext(nil, set, nil),
+			inPath:  inPath,
+			outPath: filepath.Join(tempDir, "output.jsonl"),
+			logger:  zerolog.Nop(),
+		}
+	}
+
+	expected := []datum{{"text": "hello"}, {"text": "hi"}}
+
+	t.Run("stages from flags", func(t *testing.T) {
+		c := newCtx(t,
+			"--stage", "whitespace fields=text",
+			"--stage", "dedupe fields=text",
+			"--stage", "length fields=text max=10",
+		)
+
+		assert.NoError(t, cmdPipeline(c))
+
+		res, err := load(c.outPath)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, res)
+	})
+
+	t.Run("stages from yaml recipe", func(t *testing.T) {
+		recipePath := filepath.Join(t.TempDir(), "recipe.yaml")
+		require.NoError(t, os.WriteFile(recipePath, []byte(`
+stages:
+  - stage: whitespace
+    fields: [text]
+  - stage: dedupe
+    fields: [text]
+  - stage: length
+    fields: [text]
+    max: 10
+`), 0644))
+		c := newCtx(t, "--recipe", recipePath)
+
+		assert.NoError(t, cmdPipeline(c))
+
+		res, err := load(c.outPath)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, res)
+	})
+
+	t.Run("stages from json recipe", func(t *testing.T) {
+		recipePath := filepath.Join(t.TempDir(), "recipe.json")
+		require.NoError(t, os.WriteFile(recipePath, []byte(`{"stages": [
+			{"stage": "whitespace", "fields": ["text"]},
+			{"stage": "dedupe", "fields": ["text"]},
+			{"stage": "length", "fields": ["text"], "max": 10}
+		]}`), 0644))
+		c := newCtx(t, "--recipe", recipePath)
+
+		assert.NoError(t, cmdPipeline(c))
+
+		res, err := load(c.outPath)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, res)
+	})
+
+	t.Run("stage order matters", func(t *testing.T) {
+		c := newCtx(t,
+			"--stage", "dedupe fields=text",
+			"--stage", "whitespace fields=text",
+		)
+
+		assert.NoError(t, cmdPipeline(c))
+
+		res, err := load(c.outPath)
+		assert.NoError(t, err)
+		assert.Len(t, res, 4)
+	})
+
+	t.Run("no stages", func(t *testing.T) {
+		assert.Error(t, cmdPipeline(newCtx(t)))
+	})
+
+	t.Run("unknown stage", func(t *testing.T) {
+		assert.Error(t, cmdPipeline(newCtx(t, "--stage", "psort fields=text")))
+	})
+
+	t.Run("missing fields", func(t *testing.T) {
+		assert.Error(t, cmdPipeline(newCtx(t, "--stage", "whitespace")))
+	})
+
+	t.Run("rougel dedupe", func(t *testing.T) {
+		assert.Error(t, cmdPipeline(newCtx(t, "--stage", "dedupe fields=text rougel")))
+	})
+
+	t.Run("invalid stage options", func(t *testing.T) {
+		assert.Error(t, cmdPipeline(newCtx(t, "--stage", "length fields=text")))
+	})
+
+	t.Run("rougel alias", func(t *testing.T) {
+		assert.Error(t, cmdPipeline(newCtx(t, "--stage", "dedupe fields=text rl")))
+	})
+
+	t.Run("unknown stage option", func(t *testing.T) {
+		assert.Error(t, cmdPipeline(newCtx(t, "--stage", "dedupe fields=text ignorecase")))
+	})
+
+	t.Run("empty filter string", func(t *testing.T) {
+		assert.Error(t, cmdPipeline(newCtx(t, "--stage", "filter fields=text string=")))
+	})
+
+	t.Run("invalid option value", func(t *testing.T) {
+		assert.Error(t, cmdPipeline(newCtx(t, "--stage", "length fields=text min=abc")))
+	})
+
+	t.Run("option aliases", func(t *testing.T) {
+		c := newCtx(t, "--stage", "whitespace f=text", "--stage", "dedupe f=text i")
+
+		assert.NoError(t, cmdPipeline(c))
+
+		res, err := load(c.outPath)
+		assert.NoError(t, err)
+		assert.Len(t, res, 3)
+	})
+}
@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/reactorsh/ambrosia/providers"
+)
+
+// promptBuilder builds the system prompt and prompt for each datum, either
+// from --instruction, --fields and --end-instruction, or from --template and
+// --sysprompt-template, and the few-shot examples sent before each prompt.
+type promptBuilder struct {
+	instruction    string
+	endInstruction string
+	fields         []string
+	json           bool
+	sysprompt      string
+
+	tmpl    *template.Template
+	sysTmpl *template.Template
+
+	examples []providers.Message
+}
+
+func newPromptBuilder(c *cmdCtx) (*promptBuilder, error) {
+	p := &promptBuilder{
+		instruction:    c.c.String("instruction"),
+		endInstruction: c.c.String("end-instruction"),
+		fields:         c.c.StringSlice("fields"),
+		json:           c.c.Bool("json"),
+		sysprompt:      c.c.String("sysprompt"),
+	}
+
+	if path := c.c.String("template"); path != "" {
+		if p.instruction != "" || p.endInstruction != "" || len(p.fields) > 0 || p.json {
+			return nil, errors.New("--template can't be used with --instruction, --end-instruction, --fields or --json")
+		}
+
+		t, err := loadPromptTemplate(path)
+		if err != nil {
+			return nil, err
+		}
+		p.tmpl = t
+	}
+
+	if path := c.c.String("sysprompt-template"); path != "" {
+		if p.sysprompt != "" {
+			return nil, errors.New("--sysprompt-template can't be used with --sysprompt")
+		}
+
+		t, err := loadPromptTemplate(path)
+		if err != nil {
+			return nil, err
+		}
+		p.sysTmpl = t
+	}
+
+	if path := c.c.String("examples"); path != "" {
+		examples, err := load(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load examples: %w", err)
+		}
+
+		err = p.addExamples(examples, c.c.String("example-label-field"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// addExamples turns each example into a user message, built the same way as
+// a prompt from every field except labelField, and an assistant message with
+// the value of labelField.
+func (p *promptBuilder) addExamples(examples []datum, labelField string) error {
+	for i, ex := range examples {
+		v, ok := ex[labelField]
+		if !ok || v == nil || v == "" {
+			return fmt.Errorf("example %d has no %q field", i+1, labelField)
+		}
+		label := valueToString(v)
+
+		d := make(datum, len(ex))
+		for k, v := range ex {
+			if k != labelField {
+				d[k] = v
+			}
+		}
+
+		prompt, err := p.prompt(d)
+		if err != nil {
+			return fmt.Errorf("example %d: %w", i+1, err)
+		}
+
+		p.examples = append(p.examples,
+			providers.Message{Role: providers.RoleUser, Content: prompt},
+			providers.Message{Role: providers.RoleAssistant, Content: label},
+		)
+	}
+
+	return nil
+}
+
+// prompt returns the prompt for d.
+func (p *promptBuilder) prompt(d datum) (string, error) {
+	if p.tmpl != nil {
+		return renderPrompt(p.tmpl, d)
+	}
+
+	var b strings.Builder
+
+	// Handle prompt
+	if p.instruction != "" {
+		fmt.Fprintf(&b, "%s\n\n", p.instruction)
+	}
+
+	if p.json {
+		jb, err := d.JSON(p.fields)
+		if err != nil {
+			return "", fmt.Errorf("error marshalling json: %w", err)
+		}
+		fmt.Fprintf(&b, "%s\n", string(jb))
+	} else {
+		// Handle 'all fields' case
+		if len(p.fields) == 0 {
+			for field, value := range d {
+				fmt.Fprintf(&b, "%s: %v\n", field, value)
+			}
+		}
+
+		// Handle specific fields
+		for _, field := range p.fields {
+			val, ok := d[field]
+			if ok {
+				fmt.Fprintf(&b, "%s: %v\n", field, val)
+			}
+		}
+	}
+
+	if p.endInstruction != "" {
+		fmt.Fprintf(&b, "\n%s\n", p.endInstruction)
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
+
+// system returns the system prompt for d.
+func (p *promptBuilder) system(d datum) (string, error) {
+	if p.sysTmpl != nil {
+		return renderPrompt(p.sysTmpl, d)
+	}
+	return p.sysprompt, nil
+}
+
+// promptFuncs are the helpers available in prompt templates, in addition to
+// text/template's built-ins.
+var promptFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"truncate": func(n int, v interface{}) string {
+		s := valueToString(v)
+		if r := []rune(s); len(r) > n {
+			return string(r[:n])
+		}
+		return s
+	},
+	"upper": func(v interface{}) string {
+		return strings.ToUpper(valueToString(v))
+	},
+	"lower": func(v interface{}) string {
+		return strings.ToLower(valueToString(v))
+	},
+	"trim": func(v interface{}) string {
+		return strings.TrimSpace(valueToString(v))
+	},
+	"default": func(def interface{}, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+}
+
+// loadPromptTemplate parses a text/template file.  Every field of a datum is
+// available as {{ .field }}.  Fields that a datum doesn't have print as
+// "<no value>", unless they're filled in with default.
+func loadPromptTemplate(path string) (*template.Template, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := template.New(filepath.Base(path)).
+		Funcs(promptFuncs).
+		Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	return t, nil
+}
+
+func renderPrompt(t *template.Template, d datum) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, map[string]interface{}(d)); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/reactorsh/ambrosia/providers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTemplate(t *testing.T, text string) string {
+	path := filepath.Join(t.TempDir(), "prompt.tmpl")
+	require.NoError(t, os.WriteFile(path, []byte(text), 0644))
+	return path
+}
+
+func TestPromptBuilderFields(t *testing.T) {
+	p := &promptBuilder{
+		instruction:    "Is this a question?",
+		endInstruction: "Answer yes or no.",
+		fields:         []string{"output", "input"},
+		sysprompt:      "be brief",
+	}
+
+	prompt, err := p.prompt(datum{"input": "hi", "output": "hello?", "other": 1.0})
+	require.NoError(t, err)
+	assert.Equal(t, "Is this a question?\n\noutput: hello?\ninput: hi\n\nAnswer yes or no.", prompt)
+
+	sys, err := p.system(datum{})
+	require.NoError(t, err)
+	assert.Equal(t, "be brief", sys)
+
+	p = &promptBuilder{fields: []string{"input"}, json: true}
+	prompt, err = p.prompt(datum{"input": "hi", "output": "hello?"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"input":"hi"}`, prompt)
+}
+
+func TestPromptBuilderTemplate(t *testing.T) {
+	tmpl, err := loadPromptTemplate(writeTemplate(t, `
+Is "{{ .output | truncate 5 }}" a good answer to "{{ upper .input }}"?
+Context: {{ .context | default "none" }}
+Data: {{ json .meta }}
+`))
+	require.NoError(t, err)
+
+	sysTmpl, err := loadPromptTemplate(writeTemplate(t, `You grade {{ .lang | lower }} answers.`))
+	require.NoError(t, err)
+
+	p := &promptBuilder{tmpl: tmpl, sysTmpl: sysTmpl}
+	d := datum{
+		"input":  "why?",
+		"output": "because it is",
+		"lang":   "English",
+		"meta":   map[string]interface{}{"id": 3.0},
+	}
+
+	prompt, err := p.prompt(d)
+	require.NoError(t, err)
+	assert.Equal(t, "Is \"becau\" a good answer to \"WHY?\"?\nContext: none\nData: {\"id\":3}", prompt)
+
+	sys, err := p.system(d)
+	require.NoError(t, err)
+	assert.Equal(t, "You grade english answers.", sys)
+}
+
+func TestLoadPromptTemplateErrors(t *testing.T) {
+	_, err := loadPromptTemplate(writeTemplate(t, `{{ .input `))
+	assert.Error(t, err)
+
+	_, err = loadPromptTemplate(filepath.Join(t.TempDir(), "missing.tmpl"))
+	assert.Error(t, err)
+
+	tmpl, err := loadPromptTemplate(writeTemplate(t, `{{ truncate "x" .input }}`))
+	require.NoError(t, err)
+	_, err = renderPrompt(tmpl, datum{"input": "hi"})
+	assert.Error(t, err)
+}
+
+func TestPromptBuilderExamples(t *testing.T) {
+	p := &promptBuilder{
+		instruction: "Is this a question?",
+		fields:      []string{"text"},
+	}
+
+	err := p.addExamples([]datum{
+		{"text": "how are you?", "label": "yes"},
+		{"text": "hello", "label": "no"},
+	}, "label")
+	require.NoError(t, err)
+
+	assert.Equal(t, []providers.Message{
+		{Role: providers.RoleUser, Content: "Is this a question?\n\ntext: how are you?"},
+		{Role: providers.RoleAssistant, Content: "yes"},
+		{Role: providers.RoleUser, Content: "Is this a question?\n\ntext: hello"},
+		{Role: providers.RoleAssistant, Content: "no"},
+	}, p.examples)
+
+	// The label isn't included when every field is sent.
+	p = &promptBuilder{}
+	require.NoError(t, p.addExamples([]datum{{"text": "hi", "score": 3.0}}, "score"))
+	assert.Equal(t, []providers.Message{
+		{Role: providers.RoleUser, Content: "text: hi"},
+		{Role: providers.RoleAssistant, Content: "3"},
+	}, p.examples)
+
+	err = (&promptBuilder{}).addExamples([]datum{{"text": "hi"}}, "label")
+	assert.EqualError(t, err, `example 1 has no "label" field`)
+}
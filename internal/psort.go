@@ -1,9 +1,16 @@
 package internal
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/reactorsh/ambrosia/limiter"
@@ -11,51 +18,176 @@ import (
 	"github.com/schollz/progressbar/v3"
 )
 
-func cmdPSort(c *cmdCtx) error {
-	c.logger.Info().Msg("checking for resumable outputs in output path")
+// bytesPerToken is a rough average for English text, used to guess the tokens
+// in a prompt before it's sent.
+const bytesPerToken = 4
 
-	datumCompleted, err := loadResumable(c.c.Command.Name, c.inPath)
+const (
+	retryBaseDelay = 1 * time.Second
+	retryMaxDelay  = 1 * time.Minute
+)
+
+var (
+	errInterrupted = errors.New("interrupted, run the same command again to resume")
+	errBudget      = errors.New("budget reached, run the same command again with a higher --budget to resume")
+)
+
+func cmdPSort(c *cmdCtx) (err error) {
+	hashes, err := hashData(c.data)
 	if err != nil {
 		return err
 	}
 
+	checkpointPath := psortPath(c.inPath, checkpointName)
+	prev, ok, err := loadCheckpoint(checkpointPath)
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	migrate := !ok && !c.c.Bool("dry-run")
+	if !ok {
+		prev, err = loadLegacyResumable(c.inPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	// todo holds the data left to sort, with its line number and hash at the
+	// same index of lines and todoHashes.
 	var todo []datum
-	if len(datumCompleted) > 0 {
-		c.logger.Debug().Int("count", len(datumCompleted)).Msg("resumable data found")
-		todo = datumSub(c.data, datumCompleted)
-		c.logger.Info().Int("remaining", len(todo)).Msg("resuming")
+	var lines []int
+	var todoHashes []string
+	var resumed []int
+	for i, d := range c.data {
+		if prev.take(hashes[i]) {
+			resumed = append(resumed, i)
+			continue
+		}
+		todo = append(todo, d)
+		lines = append(lines, i+1)
+		todoHashes = append(todoHashes, hashes[i])
+	}
+
+	if len(resumed) > 0 {
+		c.logger.Info().
+			Int("completed", len(resumed)).
+			Int("remaining", len(todo)).
+			Msg("resuming")
 	} else {
-		c.logger.Debug().
-			Msg("no resumable outputs found")
-		todo = c.data
+		c.logger.Debug().Msg("no resumable outputs found")
 	}
 
-	var prompter providers.Provider
+	labeler, err := newResponseLabeler(c.c.StringSlice("labels"), c.c.String("label-regex"), jsonLabelKey(c))
+	if err != nil {
+		return err
+	}
+
+	votes := intOr(c.c, "votes", 1)
+	if votes < 1 {
+		return errors.New("votes must be at least 1")
+	}
 
-	switch {
+	var sc *scorer
+	if c.c.Bool("score") {
+		if len(c.c.StringSlice("labels")) > 0 {
+			return errors.New("--labels can't be used with --score")
+		}
+		sc, err = newScorer(c.c.String("label-regex"), jsonLabelKey(c), c.c.Float64Slice("threshold"))
+		if err != nil {
+			return err
+		}
+	}
+
+	pb, err := newPromptBuilder(c)
+	if err != nil {
+		return err
+	}
+
+	sampling, err := samplingOptions(c.c)
+	if err != nil {
+		return err
+	}
+
+	reg, model, err := resolveModel(c)
+	if err != nil {
+		return err
+	}
+
+	maxTokens := modelDefault(c, "max-tokens", model.MaxTokens)
+
+	c.manifest.PSort, err = newPSortManifest(c, model, pb)
+	if err != nil {
+		return err
+	}
+
+	budget := c.c.Float64("budget")
+	if budget < 0 {
+		return errors.New("budget must not be negative")
+	}
+	if budget > 0 && !model.Priced() {
+		return fmt.Errorf("--budget needs prices for %s, set prompt_price and completion_price in --models", model)
+	}
+
+	estimate, err := estimateUsage(todo, lines, pb, votes, maxTokens)
+	if err != nil {
+		return fmt.Errorf("error building prompt: %w", err)
+	}
+
+	if !c.c.Bool("dry-run") {
+		l := c.logger.Info().
+			Int("requests", estimate.Requests).
+			Int("prompt_tokens", estimate.PromptTokens).
+			Int("completion_tokens", estimate.CompletionTokens)
+		if cost, ok := estimate.cost(model); ok {
+			l = l.Str("cost", formatCost(cost))
+		}
+		l.Msg("estimated usage")
+	}
+
+	if cost, ok := estimate.cost(model); ok && budget > 0 && cost > budget {
+		c.logger.Warn().
+			Str("estimate", formatCost(cost)).
+			Str("budget", formatCost(budget)).
+			Msg("estimated cost is over budget, the run will stop early")
+	}
 
-	case c.c.Bool("dry-run"):
+	var prompter providers.Provider
+
+	if c.c.Bool("dry-run") {
 		c.logger.Info().Msg("dry-run enabled")
 		prompter = providers.NewDryRun()
+	} else {
+		c.logger.Info().Str("model", model.String()).Msg("using model")
+		prompter, err = reg.New(model, providers.Config{
+			Token:     c.c.String("token"), // Will error on the ping if invalid
+			BaseURL:   c.c.String("baseurl"),
+			Timeout:   c.c.Duration("timeout"),
+			Logger:    c.logger,
+			MaxTokens: maxTokens,
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-	case c.c.String("model") == "gpt-3.5-turbo" || c.c.String("model") == "gpt-4":
-		c.logger.Info().Str("model", c.c.String("model")).Msg("using openai model")
-		prompter = oaiPrompter(c)
+	ctx, stop := interruptContext(c)
+	defer stop()
 
-	default:
-		return fmt.Errorf("dry-run not set and no valid model specified")
-	}
+	// runCtx is also canceled once --budget is reached.
+	runCtx, stopRun := context.WithCancel(ctx)
+	defer stopRun()
 
-	err = prompter.Ping()
+	err = prompter.Ping(ctx)
 	if err != nil {
 		return fmt.Errorf("error with model: %w", err)
 	}
 
 	reqC := make(chan providers.InferRequest, c.c.Int("concurrency")*2)
-	go submitPrompts(c, reqC, todo)
+	go submitPrompts(runCtx, c, reqC, todo, pb, sampling, model.ContextWindow-maxTokens)
 
-	respC := make(chan providers.InferResponse, c.c.Int("concurrency")*2)
-	go inference(c, prompter, reqC, respC)
+	lim := limiter.New(modelDefault(c, "rpm", model.RPM), modelDefault(c, "tpm", model.TPM), &c.logger)
+
+	resC := make(chan inferResult, c.c.Int("concurrency")*2)
+	go inference(runCtx, c, prompter, lim, reqC, resC)
 
 	pbar := progressbar.DefaultSilent(0)
 	if c.c.Bool("progress") {
@@ -63,34 +195,256 @@ func cmdPSort(c *cmdCtx) error {
 	}
 
 	appender := newPrefixAppender(prefixPathTmpl(c.inPath))
-	defer appender.close()
-	for resp := range respC {
+	defer func() {
+		closeErr := appender.close()
+		if closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	// Failures are retried on resume, so only this run's are kept.  A dry run
+	// sends nothing, so it leaves the last run's alone.
+	errorsPath := psortPath(c.inPath, "errors")
+	if !c.c.Bool("dry-run") {
+		if err := os.Remove(errorsPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// Outputs from before checkpoints existed are recorded, so the next
+	// resume doesn't need them.
+	if migrate {
+		for _, i := range resumed {
+			err := appender.append(checkpointName, datum{"line": i + 1, "hash": hashes[i]})
+			if err != nil {
+				return fmt.Errorf("error appending: %w", err)
+			}
+		}
+	}
+
+	ballots := make(map[int]*ballot)
+	var used usage
+	var overBudget bool
+
+	var done, failed, unmatched, review int
+	for res := range resC {
+		if !c.c.Bool("dry-run") {
+			used.add(res)
+			if cost, _ := used.cost(model); budget > 0 && cost >= budget && !overBudget {
+				overBudget = true
+				c.logger.Warn().
+					Str("cost", formatCost(cost)).
+					Msg("budget reached, waiting for in-flight requests")
+				stopRun()
+			}
+		}
+
+		b, ok := ballots[res.id]
+		if !ok {
+			b = &ballot{}
+			ballots[res.id] = b
+		}
+
+		switch {
+		case res.err != nil:
+			b.addFailure(res)
+		case c.c.Bool("dry-run"):
+			b.addLabel(res.resp.Resp, "")
+		case sc != nil:
+			score, ok := sc.parse(res.resp.Resp)
+			b.addScore(res.resp.Resp, score, ok)
+		default:
+			label, ok := labeler.label(res.resp.Resp)
+			if !ok {
+				label = ""
+			}
+			b.addLabel(res.resp.Resp, label)
+		}
+
+		if b.count() < votes {
+			continue
+		}
+		delete(ballots, res.id)
+
+		done++
+		if c.c.Bool("progress") {
+			pbar.Add(1)
+		}
+
+		if len(b.responses) == 0 {
+			failed++
+			c.logger.Debug().Err(b.err).Int("attempts", b.attempts).Msg("inference failed")
+			err = appender.append("errors", datum{
+				"line":     lines[res.id],
+				"error":    b.err.Error(),
+				"attempts": b.attempts,
+				"datum":    todo[res.id],
+			})
+			if err != nil {
+				return fmt.Errorf("error appending: %w", err)
+			}
+			continue
+		}
+
 		if c.c.Bool("dry-run") {
 			continue
 		}
 
-		var err error
-		if c.c.Bool("include-resp") {
-			err = appender.appendWithResponse(resp.Resp, todo[resp.ID])
+		d := todo[res.id]
+
+		var label string
+		var agreement float64
+		if sc != nil {
+			var score float64
+			score, agreement, ok = b.mean()
+			if ok {
+				d[c.c.String("score-field")] = score
+			}
+			if ok && !lowAgreement(c, votes, agreement) {
+				label = sc.add(score)
+			}
 		} else {
-			err = appender.append(resp.Resp, todo[resp.ID])
+			label, agreement, ok = b.majority()
+		}
+
+		var resp interface{} = b.responses[0]
+		if votes > 1 {
+			resp = b.responses
+			d[c.c.String("agreement-field")] = agreement
 		}
 
+		switch {
+		case !ok:
+			// Always keep the response, so it's clear why it didn't match.
+			unmatched++
+			label = "unmatched"
+			d["ambrosia"] = resp
+		case lowAgreement(c, votes, agreement):
+			review++
+			label = "review"
+			d["ambrosia"] = resp
+		case c.c.Bool("include-resp"):
+			d["ambrosia"] = resp
+		}
+
+		err = appender.append(label, d)
 		if err != nil {
 			return fmt.Errorf("error appending: %w", err)
 		}
 
-		if c.c.Bool("progress") {
-			pbar.Add(1)
+		// The checkpoint is written after the datum, so a crash in between
+		// sorts it again rather than losing it.
+		err = appender.append(checkpointName, datum{"line": lines[res.id], "hash": todoHashes[res.id]})
+		if err != nil {
+			return fmt.Errorf("error appending: %w", err)
 		}
 	}
 
+	if c.c.Bool("dry-run") {
+		if err := estimate.report(c.c.App.Writer, "estimated usage", model); err != nil {
+			return fmt.Errorf("failed to write usage: %w", err)
+		}
+	} else {
+		if err := used.report(c.c.App.Writer, "usage", model); err != nil {
+			return fmt.Errorf("failed to write usage: %w", err)
+		}
+
+		c.manifest.InRecords = len(c.data)
+		c.manifest.PSort.Usage = used
+		if cost, ok := used.cost(model); ok {
+			c.manifest.PSort.Cost = &cost
+		}
+		if err := writePSortManifests(c, appender); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+
+	if sc != nil && !c.c.Bool("dry-run") {
+		if err := sc.report(c.c.App.Writer); err != nil {
+			return fmt.Errorf("failed to write scores: %w", err)
+		}
+	}
+
+	if unmatched > 0 {
+		c.logger.Warn().
+			Int("count", unmatched).
+			Str("path", psortPath(c.inPath, "unmatched")).
+			Msg("some responses didn't match a label")
+	}
+
+	if review > 0 {
+		c.logger.Warn().
+			Int("count", review).
+			Str("path", psortPath(c.inPath, "review")).
+			Msg("some votes had low agreement")
+	}
+
+	if s := lim.Stats(); s.Waits > 0 {
+		c.logger.Info().
+			Int("waits", s.Waits).
+			Int("requests", s.Requests).
+			Str("waited", s.Waited.Round(time.Millisecond).String()).
+			Msg("some requests waited for --rpm or --tpm, raise them if your rate limits allow")
+	}
+
+	if failed > 0 {
+		c.logger.Warn().
+			Int("count", failed).
+			Str("path", errorsPath).
+			Msg("some data failed inference, run the same command again to retry it")
+	}
+
+	if runCtx.Err() != nil {
+		c.logger.Warn().
+			Int("completed", done).
+			Int("remaining", len(todo)-done).
+			Msg("stopped early, completed data has been written")
+		if ctx.Err() == nil {
+			return errBudget
+		}
+		return errInterrupted
+	}
+
 	return nil
 }
 
-func inference(c *cmdCtx, p providers.Provider, in <-chan providers.InferRequest, out chan<- providers.InferResponse) {
-	lim := limiter.New(c.c.Int("rpm"), c.c.Int("tpm"), &c.logger)
+// interruptContext returns a context that is canceled on the first SIGINT or
+// SIGTERM.  Once canceled, the signal handler is removed, so a second signal
+// exits immediately.
+func interruptContext(c *cmdCtx) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-sigC:
+			c.logger.Warn().Msg("interrupted, waiting for in-flight requests, interrupt again to exit immediately")
+			signal.Stop(sigC)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
+	return ctx, func() {
+		signal.Stop(sigC)
+		cancel()
+	}
+}
+
+// inferResult is the outcome of every attempt at a single request.
+type inferResult struct {
+	id       int
+	resp     *providers.InferResponse
+	err      error
+	attempts int
+}
+
+// inference runs queries from in until it's closed or ctx is canceled.
+// Queries already sent to the provider when ctx is canceled are allowed to
+// finish or time out, but aren't retried.
+func inference(ctx context.Context, c *cmdCtx, p providers.Provider, lim *limiter.Limiter, in <-chan providers.InferRequest, out chan<- inferResult) {
 	wg := sync.WaitGroup{}
 	wg.Add(c.c.Int("concurrency"))
 
@@ -98,32 +452,10 @@ func inference(c *cmdCtx, p providers.Provider, in <-chan providers.InferRequest
 		go func() {
 			defer wg.Done()
 			for query := range in {
-				c.logger.Debug().Interface("query", query).Msg("inference request")
-
-				// Very naive retry, good enough for now.
-				var resp *providers.InferResponse
-				var err error
-				for {
-					if !c.c.Bool("dry-run") {
-						lim.Wait(query.ByteCnt())
-					}
-					resp, err = p.Infer(&query)
-					if err != nil {
-						c.logger.Debug().
-							Err(err).
-							Interface("resp", resp).
-							Msg("inference error, retrying")
-						time.Sleep(1 * time.Second)
-						continue
-					}
-
-					break
-				}
-				c.logger.Debug().Interface("resp", resp).Msg("inference response")
-				if !c.c.Bool("dry-run") {
-					lim.TPMReconcile(query.ByteCnt(), resp.Tokens)
+				res, ok := infer(ctx, c, p, lim, &query)
+				if ok {
+					out <- res
 				}
-				out <- *resp
 			}
 		}()
 	}
@@ -132,76 +464,249 @@ func inference(c *cmdCtx, p providers.Provider, in <-chan providers.InferRequest
 	close(out)
 }
 
-func submitPrompts(c *cmdCtx, queue chan<- providers.InferRequest, data []datum) {
-	for i, d := range data {
-		var b strings.Builder
+// infer runs a single query.  Errors that are likely temporary are retried
+// with exponential backoff, up to --max-retries times.  It returns false if
+// ctx is canceled before the query succeeds or fails for good.
+func infer(ctx context.Context, c *cmdCtx, p providers.Provider, lim *limiter.Limiter, query *providers.InferRequest) (inferResult, bool) {
+	c.logger.Debug().Interface("query", query).Msg("inference request")
 
-		// Handle prompt
-		if c.c.String("instruction") != "" {
-			fmt.Fprintf(&b, "%s\n\n", c.c.String("instruction"))
-		}
+	est := estimateTokens(query)
 
-		if c.c.Bool("json") {
-			jb, err := d.JSON(c.c.StringSlice("fields"))
-			if err != nil {
-				c.logger.Fatal().Err(err).Msg("error marshalling json")
-			}
-			fmt.Fprintf(&b, "%s\n", string(jb))
-		} else {
-			// Handle 'all fields' case
-			if len(c.c.StringSlice("fields")) == 0 {
-				for field, value := range d {
-					fmt.Fprintf(&b, "%s: %v\n", field, value)
-				}
+	res := inferResult{id: query.ID}
+	for {
+		if ctx.Err() != nil {
+			return res, false
+		}
+		if !c.c.Bool("dry-run") {
+			if err := lim.Wait(ctx, est); err != nil {
+				return res, false
 			}
+		}
 
-			// Handle specific fields
-			for _, field := range c.c.StringSlice("fields") {
-				val, ok := d[field]
-				if ok {
-					fmt.Fprintf(&b, "%s: %v\n", field, val)
-				}
-			}
+		// In-flight requests are bounded by --timeout, not ctx.
+		res.attempts++
+		res.resp, res.err = p.Infer(context.Background(), query)
+		if res.err == nil {
+			break
+		}
+
+		// Failed requests don't report their tokens, so the estimate is
+		// returned rather than counted against --tpm for every retry.
+		if !c.c.Bool("dry-run") {
+			lim.TPMReconcile(est, 0)
 		}
+		syncLimiter(lim, providers.RateLimitOf(res.err))
+
+		maxRetries := c.c.Int("max-retries")
+		if !providers.Retryable(res.err) || (maxRetries >= 0 && res.attempts > maxRetries) {
+			return res, true
+		}
+
+		delay := retryDelay(res.attempts, res.err)
+		c.logger.Debug().
+			Err(res.err).
+			Int("attempts", res.attempts).
+			Dur("delay", delay).
+			Msg("inference error, retrying")
+		sleepCtx(ctx, delay)
+	}
+
+	c.logger.Debug().Interface("resp", res.resp).Msg("inference response")
+	if !c.c.Bool("dry-run") {
+		lim.TPMReconcile(est, res.resp.Tokens)
+		syncLimiter(lim, res.resp.RateLimit)
+	}
+
+	return res, true
+}
+
+// syncLimiter adjusts lim to the rate limit state reported by the server, if
+// any.
+func syncLimiter(lim *limiter.Limiter, rl *providers.RateLimit) {
+	if rl == nil {
+		return
+	}
+	lim.Sync(rl.LimitRequests, rl.LimitTokens, rl.RemainingRequests, rl.RemainingTokens)
+}
+
+// retryDelay returns how long to wait before retrying after the given number
+// of failed attempts.  The delay doubles with each attempt, up to
+// retryMaxDelay, and is jittered so concurrent workers don't retry in
+// lockstep.  A longer delay requested by the server is always honored.
+func retryDelay(attempts int, err error) time.Duration {
+	d := retryBaseDelay
+	for i := 1; i < attempts && d < retryMaxDelay; i++ {
+		d *= 2
+	}
+	if d > retryMaxDelay {
+		d = retryMaxDelay
+	}
 
-		if c.c.String("end-instruction") != "" {
-			fmt.Fprintf(&b, "\n%s\n", c.c.String("end-instruction"))
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+
+	if ra := providers.RetryAfter(err); ra > d {
+		return ra
+	}
+	return d
+}
+
+// sleepCtx sleeps for d, or until ctx is canceled.
+func sleepCtx(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// submitPrompts builds a prompt for each datum and queues it, once per vote,
+// until ctx is canceled.  If a seed is set, each vote uses the next seed so
+// that votes can differ.  If maxPrompt is positive, prompts that are likely to
+// be more than maxPrompt tokens are counted and logged.
+func submitPrompts(ctx context.Context, c *cmdCtx, queue chan<- providers.InferRequest, data []datum, pb *promptBuilder, sampling providers.Sampling, maxPrompt int) {
+	defer close(queue)
+
+	votes := intOr(c.c, "votes", 1)
+
+	var tooLong int
+	for i, d := range data {
+		prompt, err := pb.prompt(d)
+		if err != nil {
+			c.logger.Fatal().Err(err).Msg("error building prompt")
 		}
 
-		prompt := strings.TrimSpace(b.String())
+		sysprompt, err := pb.system(d)
+		if err != nil {
+			c.logger.Fatal().Err(err).Msg("error building system prompt")
+		}
 
 		req := providers.InferRequest{
 			ID:           i,
-			SystemPrompt: c.c.String("sysprompt"),
+			SystemPrompt: sysprompt,
+			Messages:     pb.examples,
 			Prompt:       prompt,
+			Sampling:     sampling,
+		}
+
+		if maxPrompt > 0 && req.ByteCnt()/bytesPerToken > maxPrompt {
+			tooLong++
+		}
+
+		// Enqueue built prompt, once per vote
+		for v := 0; v < votes; v++ {
+			if sampling.Seed != nil {
+				seed := *sampling.Seed + v
+				req.Seed = &seed
+			}
+
+			select {
+			case queue <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	if tooLong > 0 {
+		c.logger.Warn().
+			Int("count", tooLong).
+			Int("max_prompt_tokens", maxPrompt).
+			Msg("prompts may not fit in the model's context window")
+	}
+}
+
+// samplingOptions returns the sampling parameters set by flags.  Escapes such
+// as "\n" in --stop are interpreted.
+func samplingOptions(o options) (providers.Sampling, error) {
+	var s providers.Sampling
+
+	if o.IsSet("temperature") {
+		temp := o.Float64("temperature")
+		if temp < 0 {
+			return s, errors.New("temperature must not be negative")
 		}
+		s.Temperature = &temp
+	}
+
+	if o.IsSet("top-p") {
+		topP := o.Float64("top-p")
+		if topP <= 0 || topP > 1 {
+			return s, errors.New("top-p must be above 0 and at most 1")
+		}
+		s.TopP = &topP
+	}
+
+	for _, stop := range o.StringSlice("stop") {
+		if unquoted, err := strconv.Unquote(`"` + stop + `"`); err == nil {
+			stop = unquoted
+		}
+		if stop == "" {
+			return s, errors.New("empty stop sequence")
+		}
+		s.Stop = append(s.Stop, stop)
+	}
+
+	if o.IsSet("seed") {
+		seed := o.Int("seed")
+		s.Seed = &seed
+	}
 
-		// Enqueue built prompt
-		queue <- req
+	return s, nil
+}
+
+// lowAgreement reports whether too few votes agreed with the result.  By
+// default more than half must agree, or at least --min-agreement if set.
+func lowAgreement(c *cmdCtx, votes int, agreement float64) bool {
+	if votes < 2 {
+		return false
 	}
-	close(queue)
+	if c.c.IsSet("min-agreement") {
+		return agreement < c.c.Float64("min-agreement")
+	}
+	return agreement <= 0.5
 }
 
-func oaiPrompter(c *cmdCtx) *providers.OAI {
-	oaiConf := providers.OAIConfig{
-		Token:     c.c.String("token"), // Will error on the ping if invalid
-		Logger:    c.logger,
-		Timeout:   c.c.Duration("timeout"),
-		MaxTokens: c.c.Int("max-tokens"),
+// jsonLabelKey returns the key to sort by if --json-schema is set.
+func jsonLabelKey(c *cmdCtx) string {
+	if !c.c.Bool("json-schema") {
+		return ""
 	}
+	return c.c.String("label-key")
+}
 
-	var model providers.OAIModel
-	switch c.c.String("model") {
-	case "gpt-3.5-turbo":
-		model = providers.ModelGPT3Dot5Turbo
-	case "gpt-4":
-		model = providers.ModelGPT4
+// resolveModel returns the model registry, extended by --models if set, and
+// the model named by --model and --provider.
+func resolveModel(c *cmdCtx) (*providers.Registry, providers.Model, error) {
+	reg := providers.NewRegistry()
+	if c.c.String("models") != "" {
+		if err := reg.LoadFile(c.c.String("models")); err != nil {
+			return nil, providers.Model{}, fmt.Errorf("failed to load models: %w", err)
+		}
 	}
-	oaiConf.Model = model
 
-	if c.c.String("baseurl") != "" {
-		oaiConf.BaseURL = c.c.String("baseurl")
+	spec := c.c.String("model")
+	if c.c.String("provider") != "" {
+		spec = c.c.String("provider") + ":" + spec
 	}
 
-	return providers.NewOAI(oaiConf)
+	model, err := reg.Resolve(spec)
+	if err != nil {
+		return nil, providers.Model{}, err
+	}
+
+	if c.c.String("provider") != "" && model.Provider != c.c.String("provider") {
+		return nil, providers.Model{}, fmt.Errorf("unknown provider %q, must be one of %s", c.c.String("provider"), strings.Join(reg.Providers(), ", "))
+	}
+
+	return reg, model, nil
+}
+
+// modelDefault returns the named flag if it's set, otherwise the model's
+// default, if it has one, and otherwise the flag's default.
+func modelDefault(c *cmdCtx, name string, def int) int {
+	if c.c.IsSet(name) || def == 0 {
+		return c.c.Int(name)
+	}
+	return def
 }
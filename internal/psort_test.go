@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reactorsh/ambrosia/providers"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestRetryDelay(t *testing.T) {
+	err := errors.New("connection reset")
+
+	for attempts, want := range map[int]time.Duration{
+		1:  retryBaseDelay,
+		2:  2 * retryBaseDelay,
+		3:  4 * retryBaseDelay,
+		20: retryMaxDelay,
+	} {
+		d := retryDelay(attempts, err)
+		assert.GreaterOrEqual(t, d, want/2, "attempts %d", attempts)
+		assert.LessOrEqual(t, d, want, "attempts %d", attempts)
+	}
+
+	rateLimited := &providers.APIError{StatusCode: 429, RetryAfter: 90 * time.Second}
+	assert.Equal(t, 90*time.Second, retryDelay(1, rateLimited))
+}
+
+func TestSamplingOptions(t *testing.T) {
+	s, err := samplingOptions(stageOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, providers.Sampling{}, s)
+
+	s, err = samplingOptions(stageOptions{
+		"temperature": 0,
+		"top-p":       0.9,
+		"stop":        []interface{}{`\n`, "END"},
+		"seed":        42,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, *s.Temperature)
+	assert.Equal(t, 0.9, *s.TopP)
+	assert.Equal(t, []string{"\n", "END"}, s.Stop)
+	assert.Equal(t, 42, *s.Seed)
+
+	_, err = samplingOptions(stageOptions{"temperature": -1})
+	assert.Error(t, err)
+
+	_, err = samplingOptions(stageOptions{"top-p": 0})
+	assert.Error(t, err)
+}
+
+func TestCmdPSort(t *testing.T) {
+	// The fake model answers with the text of each datum.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tags" {
+			w.Write([]byte(`{"models": [{"name": "llama3:latest"}]}`))
+			return
+		}
+
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		prompt := req.Messages[len(req.Messages)-1].Content
+		_, text, _ := strings.Cut(prompt, "text: ")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": map[string]string{"role": "assistant", "content": strings.TrimSpace(text)},
+			"done":    true,
+		})
+	}))
+	defer srv.Close()
+
+	data := []datum{
+		{"text": "yes"},
+		{"text": "no"},
+		{"text": "maybe"},
+		{"text": "checkpoint"},
+		{"text": "errors"},
+	}
+
+	inPath := filepath.Join(t.TempDir(), "input.jsonl")
+	require.NoError(t, write(inPath, data))
+	hashes, err := hashData(data)
+	require.NoError(t, err)
+
+	set := flag.NewFlagSet("test", 0)
+	set.Var(cli.NewStringSlice("text"), "fields", "doc")
+	set.Var(cli.NewStringSlice("yes", "no"), "labels", "doc")
+	set.String("provider", "ollama", "doc")
+	set.String("model", "llama3", "doc")
+	set.String("baseurl", srv.URL, "doc")
+	set.Int("concurrency", 2, "doc")
+
+	c := &cmdCtx{
+		c:      cli.NewContext(cli.NewApp(), set, nil),
+		inPath: inPath,
+		logger: zerolog.Nop(),
+		data:   data,
+	}
+	require.NoError(t, cmdPSort(c))
+
+	sorted := func(label string) []datum {
+		res, err := load(psortPath(inPath, label))
+		require.NoError(t, err)
+		for _, d := range res {
+			delete(d, "ambrosia")
+		}
+		return res
+	}
+
+	assert.Equal(t, []datum{{"text": "yes"}}, sorted("yes"))
+	assert.Equal(t, []datum{{"text": "no"}}, sorted("no"))
+
+	// Responses outside --labels, including reserved names, are unmatched.
+	assert.ElementsMatch(t, []datum{
+		{"text": "maybe"},
+		{"text": "checkpoint"},
+		{"text": "errors"},
+	}, sorted("unmatched"))
+	assert.NoFileExists(t, psortPath(inPath, "errors"))
+
+	cp, ok, err := loadCheckpoint(psortPath(inPath, checkpointName))
+	require.NoError(t, err)
+	require.True(t, ok)
+	for _, h := range hashes {
+		assert.True(t, cp.take(h))
+	}
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// scoreRegex finds the first number in a response, when --label-regex isn't
+// set.
+const scoreRegex = `[-+]?\d+(?:\.\d+)?`
+
+// maxScoreBins is the most histogram bins shown for integer scores, so
+// scores of 1 to 10 get one bin each.
+const maxScoreBins = 20
+
+// scorer parses a numeric score from psort responses, and picks the file each
+// scored datum is written to.  With no thresholds, everything is written to
+// "scored".  Otherwise thresholds split scores into ranges, e.g. 4 and 7 give
+// "lt4", "4to7" and "ge7", with each range including its lower bound.
+type scorer struct {
+	labeler    *responseLabeler
+	thresholds []float64
+	scores     []float64
+	buckets    map[string]int
+}
+
+func newScorer(labelRegex string, jsonKey string, thresholds []float64) (*scorer, error) {
+	if labelRegex == "" {
+		labelRegex = scoreRegex
+	}
+
+	labeler, err := newResponseLabeler(nil, labelRegex, jsonKey)
+	if err != nil {
+		return nil, err
+	}
+
+	thresholds = append([]float64(nil), thresholds...)
+	sort.Float64s(thresholds)
+	for i := 1; i < len(thresholds); i++ {
+		if thresholds[i] == thresholds[i-1] {
+			return nil, fmt.Errorf("duplicate threshold %s", formatScore(thresholds[i]))
+		}
+	}
+
+	return &scorer{
+		labeler:    labeler,
+		thresholds: thresholds,
+		buckets:    make(map[string]int),
+	}, nil
+}
+
+// parse returns the score in resp, or false if there isn't one.
+func (s *scorer) parse(resp string) (float64, bool) {
+	v, ok := s.labeler.label(resp)
+	if !ok {
+		return 0, false
+	}
+
+	score, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(score) || math.IsInf(score, 0) {
+		return 0, false
+	}
+
+	return score, true
+}
+
+// add records score for the report, and returns its bucket.
+func (s *scorer) add(score float64) string {
+	b := s.bucket(score)
+	s.scores = append(s.scores, score)
+	s.buckets[b]++
+	return b
+}
+
+// bucket returns the name of the file score is written to.
+func (s *scorer) bucket(score float64) string {
+	if len(s.thresholds) == 0 {
+		return "scored"
+	}
+
+	i := sort.Search(len(s.thresholds), func(i int) bool {
+		return s.thresholds[i] > score
+	})
+
+	switch i {
+	case 0:
+		return "lt" + formatScore(s.thresholds[0])
+	case len(s.thresholds):
+		return "ge" + formatScore(s.thresholds[i-1])
+	default:
+		return formatScore(s.thresholds[i-1]) + "to" + formatScore(s.thresholds[i])
+	}
+}
+
+// bucketNames returns every bucket name, lowest scores first.
+func (s *scorer) bucketNames() []string {
+	if len(s.thresholds) == 0 {
+		return []string{"scored"}
+	}
+
+	ret := []string{s.bucket(math.Inf(-1))}
+	for _, t := range s.thresholds {
+		ret = append(ret, s.bucket(t))
+	}
+	return ret
+}
+
+// report prints the distribution of the recorded scores, and how many were
+// written to each bucket.
+func (s *scorer) report(w io.Writer) error {
+	fmt.Fprintf(w, "scores: %d\n", len(s.scores))
+	if len(s.scores) == 0 {
+		return nil
+	}
+
+	sorted := append([]float64(nil), s.scores...)
+	sort.Float64s(sorted)
+
+	var total float64
+	integral := true
+	for _, v := range sorted {
+		total += v
+		if v != math.Trunc(v) {
+			integral = false
+		}
+	}
+
+	fmt.Fprintf(w, "  min   %s\n", formatScore(sorted[0]))
+	fmt.Fprintf(w, "  max   %s\n", formatScore(sorted[len(sorted)-1]))
+	fmt.Fprintf(w, "  mean  %.2f\n", total/float64(len(sorted)))
+	fmt.Fprintf(w, "  p50   %s\n", formatScore(sorted[(len(sorted)-1)/2]))
+
+	// Fractional scores, e.g. 0.0 to 1.0, would all land in a few integer
+	// bins, so only integer scores get a histogram.
+	if integral {
+		ints := make([]int, len(sorted))
+		for i, v := range sorted {
+			ints[i] = int(v)
+		}
+		fmt.Fprintf(w, "  histogram\n")
+		printHistogram(w, buildHistogram(ints, maxScoreBins))
+	}
+
+	if len(s.thresholds) > 0 {
+		fmt.Fprintf(w, "  files\n")
+		for _, b := range s.bucketNames() {
+			fmt.Fprintf(w, "    %-12s %d\n", b, s.buckets[b])
+		}
+	}
+
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+func formatScore(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScorerScore(t *testing.T) {
+	s, err := newScorer("", "", nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		resp   string
+		want   float64
+		wantOK bool
+	}{
+		{"10", 10, true},
+		{"Score: 7/10", 7, true},
+		{" 3.5", 3.5, true},
+		{"-2", -2, true},
+		{"ten", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := s.parse(tt.resp)
+		assert.Equal(t, tt.wantOK, ok, tt.resp)
+		assert.Equal(t, tt.want, got, tt.resp)
+	}
+}
+
+func TestScorerJSON(t *testing.T) {
+	s, err := newScorer("", "quality", nil)
+	require.NoError(t, err)
+
+	got, ok := s.parse(`{"quality": 8, "reason": "clear"}`)
+	assert.True(t, ok)
+	assert.Equal(t, 8.0, got)
+
+	got, ok = s.parse(`{"quality": "9/10"}`)
+	assert.True(t, ok)
+	assert.Equal(t, 9.0, got)
+}
+
+func TestScorerBucket(t *testing.T) {
+	s, err := newScorer("", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "scored", s.bucket(10))
+
+	s, err = newScorer("", "", []float64{7, 4})
+	require.NoError(t, err)
+	assert.Equal(t, "lt4", s.bucket(1))
+	assert.Equal(t, "4to7", s.bucket(4))
+	assert.Equal(t, "4to7", s.bucket(6.9))
+	assert.Equal(t, "ge7", s.bucket(7))
+	assert.Equal(t, "ge7", s.bucket(10))
+	assert.Equal(t, "ge7", s.add(8))
+	assert.Equal(t, []float64{8}, s.scores)
+	assert.Equal(t, []string{"lt4", "4to7", "ge7"}, s.bucketNames())
+
+	s, err = newScorer("", "", []float64{0.5})
+	require.NoError(t, err)
+	assert.Equal(t, "lt0.5", s.bucket(0.2))
+	assert.Equal(t, "ge0.5", s.bucket(0.5))
+
+	_, err = newScorer("", "", []float64{5, 5})
+	assert.Error(t, err)
+}
+
+func TestScorerReport(t *testing.T) {
+	s, err := newScorer("", "", []float64{5})
+	require.NoError(t, err)
+
+	for _, score := range []float64{1, 10, 10, 6} {
+		s.add(score)
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, s.report(&b))
+
+	out := b.String()
+	assert.Contains(t, out, "scores: 4\n")
+	assert.Contains(t, out, "  min   1\n")
+	assert.Contains(t, out, "  max   10\n")
+	assert.Contains(t, out, "  mean  6.75\n")
+	assert.Contains(t, out, "  p50   6\n")
+	assert.Contains(t, out, "  histogram\n")
+	assert.Contains(t, out, "    lt5          1\n")
+	assert.Contains(t, out, "    ge5          3\n")
+}
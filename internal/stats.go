@@ -0,0 +1,306 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultHistogramBins = 10
+	histogramWidth       = 40
+)
+
+func cmdStats(c *cmdCtx) error {
+	measure, err := newMeasureFn(c.c)
+	if err != nil {
+		return err
+	}
+
+	bins := intOr(c.c, "bins", defaultHistogramBins)
+	if bins < 1 {
+		return errors.New("bins must be at least 1")
+	}
+
+	sc := newStatsCollector(c.c.StringSlice("fields"), measure)
+
+	r, err := newDatumReader(c.inPath)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	for {
+		d, _, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read data: %w", err)
+		}
+		sc.add(d)
+	}
+
+	unit := c.c.String("unit")
+	if unit == "" {
+		unit = "bytes"
+	}
+	report := sc.report(unit, bins)
+
+	if c.c.Bool("json") {
+		enc := json.NewEncoder(c.c.App.Writer)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = report.print(c.c.App.Writer)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+
+	c.logger = c.logger.With().Int("in_record_count", report.Records).Logger()
+	c.logger.Info().Msg("finished calculating stats")
+
+	return nil
+}
+
+// statsCollector records the length of every field of every datum, measured
+// the same way as the length command.  Lengths are kept in memory so that
+// exact percentiles can be reported.
+type statsCollector struct {
+	fields  []string
+	measure measureFn
+	records int
+
+	lengths   [][]int
+	missing   []int
+	nonString []int
+
+	// sums holds the summed length of the fields present in each datum, and
+	// sumMissing counts data with none of the fields.
+	sums       []int
+	sumMissing int
+}
+
+func newStatsCollector(fields []string, measure measureFn) *statsCollector {
+	return &statsCollector{
+		fields:    fields,
+		measure:   measure,
+		lengths:   make([][]int, len(fields)),
+		missing:   make([]int, len(fields)),
+		nonString: make([]int, len(fields)),
+	}
+}
+
+func (sc *statsCollector) add(d datum) {
+	sc.records++
+
+	var sum int
+	var found bool
+	for i, f := range sc.fields {
+		v, ok := d[f]
+		if !ok {
+			sc.missing[i]++
+			continue
+		}
+		if _, ok := v.(string); !ok {
+			sc.nonString[i]++
+		}
+
+		l := sc.measure(valueToString(v))
+		sc.lengths[i] = append(sc.lengths[i], l)
+		sum += l
+		found = true
+	}
+
+	if !found {
+		sc.sumMissing++
+		return
+	}
+	sc.sums = append(sc.sums, sum)
+}
+
+type statsReport struct {
+	Unit    string         `json:"unit"`
+	Records int            `json:"records"`
+	Fields  []*lengthStats `json:"fields"`
+
+	// Sum is only set when there is more than one field.
+	Sum *lengthStats `json:"sum,omitempty"`
+}
+
+type lengthStats struct {
+	Field     string      `json:"field"`
+	Count     int         `json:"count"`
+	Missing   int         `json:"missing"`
+	NonString int         `json:"non_string"`
+	Min       int         `json:"min"`
+	Max       int         `json:"max"`
+	Mean      float64     `json:"mean"`
+	P50       int         `json:"p50"`
+	P90       int         `json:"p90"`
+	P99       int         `json:"p99"`
+	Histogram []histogram `json:"histogram"`
+}
+
+// histogram is a single bucket, holding the lengths from Min to Max
+// inclusive.
+type histogram struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Count int `json:"count"`
+}
+
+func (sc *statsCollector) report(unit string, bins int) *statsReport {
+	r := &statsReport{
+		Unit:    unit,
+		Records: sc.records,
+	}
+
+	for i, f := range sc.fields {
+		s := newLengthStats(f, sc.lengths[i], bins)
+		s.Missing = sc.missing[i]
+		s.NonString = sc.nonString[i]
+		r.Fields = append(r.Fields, s)
+	}
+
+	if len(sc.fields) > 1 {
+		r.Sum = newLengthStats(strings.Join(sc.fields, "+"), sc.sums, bins)
+		r.Sum.Missing = sc.sumMissing
+	}
+
+	return r
+}
+
+// newLengthStats summarizes lengths, sorting it in place.
+func newLengthStats(field string, lengths []int, bins int) *lengthStats {
+	s := &lengthStats{
+		Field: field,
+		Count: len(lengths),
+	}
+	if len(lengths) == 0 {
+		return s
+	}
+
+	sort.Ints(lengths)
+
+	var total int
+	for _, l := range lengths {
+		total += l
+	}
+
+	s.Min = lengths[0]
+	s.Max = lengths[len(lengths)-1]
+	s.Mean = float64(total) / float64(len(lengths))
+	s.P50 = percentile(lengths, 50)
+	s.P90 = percentile(lengths, 90)
+	s.P99 = percentile(lengths, 99)
+	s.Histogram = buildHistogram(lengths, bins)
+
+	return s
+}
+
+// percentile returns the nearest-rank percentile p of sorted.
+func percentile(sorted []int, p float64) int {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// buildHistogram splits sorted into at most bins equal-width buckets spanning
+// its min to max.
+func buildHistogram(sorted []int, bins int) []histogram {
+	min, max := sorted[0], sorted[len(sorted)-1]
+
+	width := (max - min + bins) / bins
+	if width < 1 {
+		width = 1
+	}
+
+	n := (max-min)/width + 1
+	ret := make([]histogram, n)
+	for i := range ret {
+		ret[i].Min = min + i*width
+		ret[i].Max = ret[i].Min + width - 1
+	}
+
+	for _, l := range sorted {
+		ret[(l-min)/width].Count++
+	}
+
+	return ret
+}
+
+func (r *statsReport) print(w io.Writer) error {
+	fmt.Fprintf(w, "records: %d, unit: %s\n", r.Records, r.Unit)
+
+	for _, s := range r.Fields {
+		fmt.Fprintln(w)
+		s.print(w)
+	}
+
+	if r.Sum != nil {
+		fmt.Fprintln(w)
+		r.Sum.print(w)
+	}
+
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+func (s *lengthStats) print(w io.Writer) {
+	fmt.Fprintf(w, "%s\n", s.Field)
+	fmt.Fprintf(w, "  count       %d\n", s.Count)
+	fmt.Fprintf(w, "  missing     %d\n", s.Missing)
+	fmt.Fprintf(w, "  non-string  %d\n", s.NonString)
+
+	if s.Count == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "  min         %d\n", s.Min)
+	fmt.Fprintf(w, "  max         %d\n", s.Max)
+	fmt.Fprintf(w, "  mean        %.1f\n", s.Mean)
+	fmt.Fprintf(w, "  p50         %d\n", s.P50)
+	fmt.Fprintf(w, "  p90         %d\n", s.P90)
+	fmt.Fprintf(w, "  p99         %d\n", s.P99)
+
+	fmt.Fprintf(w, "  histogram\n")
+	printHistogram(w, s.Histogram)
+}
+
+// printHistogram prints one indented line per bucket, with a bar scaled to the
+// largest bucket.
+func printHistogram(w io.Writer, hist []histogram) {
+	var most int
+	var labelWidth int
+	for _, b := range hist {
+		if b.Count > most {
+			most = b.Count
+		}
+		if l := len(b.label()); l > labelWidth {
+			labelWidth = l
+		}
+	}
+
+	for _, b := range hist {
+		bar := b.Count * histogramWidth / most
+		if bar == 0 && b.Count > 0 {
+			bar = 1
+		}
+		fmt.Fprintf(w, "    %*s  %-*s %d\n", labelWidth, b.label(), histogramWidth, strings.Repeat("#", bar), b.Count)
+	}
+}
+
+func (b histogram) label() string {
+	if b.Min == b.Max {
+		return fmt.Sprintf("%d", b.Min)
+	}
+	return fmt.Sprintf("%d-%d", b.Min, b.Max)
+}
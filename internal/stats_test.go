@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	assert.Equal(t, 5, percentile(sorted, 50))
+	assert.Equal(t, 9, percentile(sorted, 90))
+	assert.Equal(t, 10, percentile(sorted, 99))
+	assert.Equal(t, 1, percentile(sorted, 0))
+	assert.Equal(t, 7, percentile([]int{7}, 50))
+}
+
+func TestBuildHistogram(t *testing.T) {
+	t.Run("even", func(t *testing.T) {
+		h := buildHistogram([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 5)
+		assert.Equal(t, []histogram{
+			{Min: 0, Max: 1, Count: 2},
+			{Min: 2, Max: 3, Count: 2},
+			{Min: 4, Max: 5, Count: 2},
+			{Min: 6, Max: 7, Count: 2},
+			{Min: 8, Max: 9, Count: 2},
+		}, h)
+	})
+
+	t.Run("narrow range", func(t *testing.T) {
+		h := buildHistogram([]int{3, 3, 4}, 10)
+		assert.Equal(t, []histogram{
+			{Min: 3, Max: 3, Count: 2},
+			{Min: 4, Max: 4, Count: 1},
+		}, h)
+	})
+
+	t.Run("single value", func(t *testing.T) {
+		h := buildHistogram([]int{5, 5}, 10)
+		assert.Equal(t, []histogram{{Min: 5, Max: 5, Count: 2}}, h)
+	})
+}
+
+func TestStatsCollector(t *testing.T) {
+	measure, err := newMeasureFn(stageOptions{})
+	require.NoError(t, err)
+
+	sc := newStatsCollector([]string{"a", "b"}, measure)
+	sc.add(datum{"a": "abc", "b": "de"})
+	sc.add(datum{"a": 12.5})
+	sc.add(datum{"c": "x"})
+
+	r := sc.report("bytes", 10)
+	assert.Equal(t, 3, r.Records)
+	require.Len(t, r.Fields, 2)
+
+	a := r.Fields[0]
+	assert.Equal(t, "a", a.Field)
+	assert.Equal(t, 2, a.Count)
+	assert.Equal(t, 1, a.Missing)
+	assert.Equal(t, 1, a.NonString)
+	assert.Equal(t, 3, a.Min)
+	assert.Equal(t, 4, a.Max)
+	assert.Equal(t, 3.5, a.Mean)
+
+	b := r.Fields[1]
+	assert.Equal(t, 1, b.Count)
+	assert.Equal(t, 2, b.Missing)
+	assert.Equal(t, 0, b.NonString)
+
+	require.NotNil(t, r.Sum)
+	assert.Equal(t, "a+b", r.Sum.Field)
+	assert.Equal(t, 2, r.Sum.Count)
+	assert.Equal(t, 1, r.Sum.Missing)
+	assert.Equal(t, 4, r.Sum.Min)
+	assert.Equal(t, 5, r.Sum.Max)
+
+	single := newStatsCollector([]string{"a"}, measure)
+	single.add(datum{"a": "abc"})
+	assert.Nil(t, single.report("bytes", 10).Sum)
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"io"
+	"os"
+)
+
+// recordFn processes a single datum read from line, modifying it in place if
+// needed.  It returns a non-empty reason if the datum should be dropped from
+// the output.
+type recordFn func(line int, d datum) (string, error)
+
+// stream reads the input file one datum at a time, passes each datum to fn,
+// and writes the data fn keeps to the output file.  Dropped data is written to
+// the rejects file, if one was requested.  Only a single datum is held in
+// memory at a time.  If an error stops the stream, the partial output and
+// rejects files are removed, so the command can be run again.
+func stream(c *cmdCtx, fn recordFn) (in int, out int, err error) {
+	r, err := newDatumReader(c.inPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer r.close()
+
+	w, err := newDatumWriter(c.outPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		closeErr := w.close()
+		if closeErr != nil && err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(c.outPath)
+		}
+	}()
+
+	rw, err := newRejectWriter(c.rejectsPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		closeErr := rw.close()
+		if closeErr != nil && err == nil {
+			err = closeErr
+		}
+		if err != nil && c.rejectsPath != "" {
+			os.Remove(c.rejectsPath)
+		}
+	}()
+
+	for {
+		d, line, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return in, out, err
+		}
+		in++
+
+		reason, err := fn(line, d)
+		if err != nil {
+			return in, out, err
+		}
+		if reason != "" {
+			if err := rw.write(line, reason, d); err != nil {
+				return in, out, err
+			}
+			continue
+		}
+
+		if err := w.write(d); err != nil {
+			return in, out, err
+		}
+		out++
+	}
+
+	c.manifest.InRecords, c.manifest.OutRecords = in, out
+	c.manifest.InputSHA256 = r.sum()
+
+	return in, out, nil
+}
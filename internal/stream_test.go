@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// applyRecordFn runs fn over data in memory and returns the data it keeps.
+func applyRecordFn(t *testing.T, fn recordFn, data []datum) []datum {
+	ret := make([]datum, 0)
+	for i, d := range data {
+		reason, err := fn(i+1, d)
+		require.NoError(t, err)
+		if reason == "" {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
+
+func TestStream(t *testing.T) {
+	newCtx := func(t *testing.T, data []datum) *cmdCtx {
+		tempDir := t.TempDir()
+		inPath := filepath.Join(tempDir, "input.jsonl")
+		require.NoError(t, write(inPath, data))
+
+		return &cmdCtx{
+			c:       cli.NewContext(nil, flag.NewFlagSet("test", 0), nil),
+			inPath:  inPath,
+			outPath: filepath.Join(tempDir, "output.jsonl"),
+			logger:  zerolog.Nop(),
+		}
+	}
+
+	t.Run("keeps and drops data", func(t *testing.T) {
+		c := newCtx(t, []datum{{"key": "a"}, {"key": "b"}, {"key": "c"}})
+
+		var lines []int
+		in, out, err := stream(c, func(line int, d datum) (string, error) {
+			lines = append(lines, line)
+			if d["key"] == "b" {
+				return "is b", nil
+			}
+			return "", nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, in)
+		assert.Equal(t, 2, out)
+		assert.Equal(t, []int{1, 2, 3}, lines)
+
+		// The input is hashed as it's read.
+		sum, err := hashFile(c.inPath)
+		require.NoError(t, err)
+		assert.Equal(t, sum, c.manifest.InputSHA256)
+
+		res, err := load(c.outPath)
+		assert.NoError(t, err)
+		assert.Equal(t, []datum{{"key": "a"}, {"key": "c"}}, res)
+	})
+
+	t.Run("writes rejects", func(t *testing.T) {
+		c := newCtx(t, []datum{{"key": "a"}, {"key": "b"}})
+		c.rejectsPath = filepath.Join(t.TempDir(), "rejects.jsonl")
+
+		_, _, err := stream(c, func(line int, d datum) (string, error) {
+			if d["key"] == "b" {
+				return "is b", nil
+			}
+			return "", nil
+		})
+		assert.NoError(t, err)
+
+		res, err := load(c.rejectsPath)
+		assert.NoError(t, err)
+		assert.Equal(t, []datum{
+			{"line": 2.0, "reason": "is b", "datum": map[string]interface{}{"key": "b"}},
+		}, res)
+	})
+
+	t.Run("writes modified data", func(t *testing.T) {
+		c := newCtx(t, []datum{{"key": "a"}})
+
+		_, _, err := stream(c, func(line int, d datum) (string, error) {
+			d["key"] = "b"
+			return "", nil
+		})
+		assert.NoError(t, err)
+
+		res, err := load(c.outPath)
+		assert.NoError(t, err)
+		assert.Equal(t, []datum{{"key": "b"}}, res)
+	})
+
+	t.Run("returns fn errors", func(t *testing.T) {
+		c := newCtx(t, []datum{{"key": "a"}})
+
+		fnErr := errors.New("fn error")
+		_, _, err := stream(c, func(line int, d datum) (string, error) {
+			return "", fnErr
+		})
+		assert.ErrorIs(t, err, fnErr)
+	})
+
+	t.Run("removes partial output on error", func(t *testing.T) {
+		c := newCtx(t, []datum{{"key": "a"}, {"key": "b"}, {"key": "c"}})
+		c.rejectsPath = filepath.Join(t.TempDir(), "rejects.jsonl")
+
+		fnErr := errors.New("fn error")
+		fn := func(line int, d datum) (string, error) {
+			switch d["key"] {
+			case "a":
+				return "is a", nil
+			case "c":
+				return "", fnErr
+			}
+			return "", nil
+		}
+		_, _, err := stream(c, fn)
+		assert.ErrorIs(t, err, fnErr)
+		assert.NoFileExists(t, c.outPath)
+		assert.NoFileExists(t, c.rejectsPath)
+
+		// The next run isn't stopped by a leftover output file.
+		_, _, err = stream(c, func(line int, d datum) (string, error) {
+			return "", nil
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("output file already exists", func(t *testing.T) {
+		c := newCtx(t, []datum{{"key": "a"}})
+		require.NoError(t, os.WriteFile(c.outPath, nil, 0644))
+
+		_, _, err := stream(c, func(line int, d datum) (string, error) {
+			return "", nil
+		})
+		assert.Error(t, err)
+	})
+}
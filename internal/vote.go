@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"sort"
+)
+
+// ballot collects the results of every request for a single datum, when
+// psort samples each datum --votes times.
+type ballot struct {
+	responses []string
+	failed    int
+	attempts  int
+	err       error
+
+	// labels holds the label of each successful response, "" if it didn't
+	// match, and scores holds each parsed score in --score mode.
+	labels []string
+	scores []float64
+}
+
+// addFailure records a request that failed for good.
+func (b *ballot) addFailure(res inferResult) {
+	b.failed++
+	b.attempts += res.attempts
+	b.err = res.err
+}
+
+// addLabel records a response and its label, "" if it didn't match.
+func (b *ballot) addLabel(resp string, label string) {
+	b.responses = append(b.responses, resp)
+	b.labels = append(b.labels, label)
+}
+
+// addScore records a response and its score, if it had one.
+func (b *ballot) addScore(resp string, score float64, ok bool) {
+	b.responses = append(b.responses, resp)
+	if ok {
+		b.scores = append(b.scores, score)
+	}
+}
+
+// count returns the number of results recorded, successful or not.
+func (b *ballot) count() int {
+	return len(b.responses) + b.failed
+}
+
+// majority returns the most common label, and the share of successful
+// responses that agree with it.  Ties go to the label that sorts first, so
+// results don't depend on the order responses arrive in.  ok is false if the
+// most common result is an unmatched response.
+func (b *ballot) majority() (label string, agreement float64, ok bool) {
+	if len(b.labels) == 0 {
+		return "", 0, false
+	}
+
+	counts := make(map[string]int)
+	for _, l := range b.labels {
+		counts[l]++
+	}
+
+	var best string
+	var bestCnt int
+	for l, cnt := range counts {
+		if cnt > bestCnt || (cnt == bestCnt && l < best) {
+			best, bestCnt = l, cnt
+		}
+	}
+
+	return best, float64(bestCnt) / float64(len(b.labels)), best != ""
+}
+
+// mean returns the mean score, and the share of successful responses that
+// gave the most common score.  ok is false if no response had a score.
+func (b *ballot) mean() (score float64, agreement float64, ok bool) {
+	if len(b.scores) == 0 {
+		return 0, 0, false
+	}
+
+	sorted := append([]float64(nil), b.scores...)
+	sort.Float64s(sorted)
+
+	var total float64
+	var bestCnt, run int
+	for i, s := range sorted {
+		total += s
+		if i > 0 && s == sorted[i-1] {
+			run++
+		} else {
+			run = 1
+		}
+		if run > bestCnt {
+			bestCnt = run
+		}
+	}
+
+	return total / float64(len(sorted)), float64(bestCnt) / float64(len(b.responses)), true
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBallotMajority(t *testing.T) {
+	b := &ballot{}
+	b.addLabel("Yes", "yes")
+	b.addLabel("no", "no")
+	b.addLabel("yes.", "yes")
+	b.addFailure(inferResult{err: errors.New("timeout"), attempts: 3})
+
+	assert.Equal(t, 4, b.count())
+	assert.Equal(t, []string{"Yes", "no", "yes."}, b.responses)
+
+	label, agreement, ok := b.majority()
+	assert.True(t, ok)
+	assert.Equal(t, "yes", label)
+	assert.InDelta(t, 2.0/3.0, agreement, 1e-9)
+}
+
+func TestBallotMajorityTie(t *testing.T) {
+	b := &ballot{}
+	b.addLabel("no", "no")
+	b.addLabel("yes", "yes")
+
+	label, agreement, ok := b.majority()
+	assert.True(t, ok)
+	assert.Equal(t, "no", label)
+	assert.Equal(t, 0.5, agreement)
+}
+
+func TestBallotMajorityUnmatched(t *testing.T) {
+	b := &ballot{}
+	b.addLabel("maybe", "")
+	b.addLabel("perhaps", "")
+	b.addLabel("yes", "yes")
+
+	_, agreement, ok := b.majority()
+	assert.False(t, ok)
+	assert.InDelta(t, 2.0/3.0, agreement, 1e-9)
+
+	_, _, ok = (&ballot{}).majority()
+	assert.False(t, ok)
+}
+
+func TestBallotMean(t *testing.T) {
+	b := &ballot{}
+	b.addScore("7", 7, true)
+	b.addScore("8", 8, true)
+	b.addScore("7", 7, true)
+	b.addScore("great", 0, false)
+
+	score, agreement, ok := b.mean()
+	assert.True(t, ok)
+	assert.InDelta(t, 22.0/3.0, score, 1e-9)
+	assert.Equal(t, 0.5, agreement)
+
+	_, _, ok = (&ballot{responses: []string{"great"}}).mean()
+	assert.False(t, ok)
+}
@@ -5,35 +5,54 @@ import (
 )
 
 func cmdWhitespace(c *cmdCtx) error {
-	fields := c.c.StringSlice("fields")
+	s := newWhitespaceStage(c, c.c)
 
 	c.logger.Info().Msg("trimming whitespace")
-	var trimmed []datum
-	var trimCnt int
-	for i, datum := range c.data {
-		for _, field := range fields {
-			s, ok := datum[field].(string)
-			if !ok {
-				continue
-			}
-			sTrm := strings.TrimSpace(s)
-			if s != sTrm {
-				trimCnt++
-				c.logger.Debug().
-					Int("line", i+1).
-					Str("field", field).
-					Str("before", s).
-					Str("after", sTrm).
-					Msg("trimmed whitespace")
-			}
-			datum[field] = sTrm
-
-		}
-		trimmed = append(trimmed, datum)
+	in, out, err := stream(c, s.apply)
+	if err != nil {
+		return err
 	}
-	c.logger = c.logger.With().Int("trim_count", trimCnt).Logger()
+
+	c.logger = c.logger.With().
+		Int("in_record_count", in).
+		Int("out_record_count", out).
+		Int("trim_count", s.trimCnt).
+		Logger()
 	c.logger.Info().Msg("trimmed whitespace")
 
-	c.logger.Info().Msg("writing trimmed data")
-	return write(c.outPath, trimmed)
+	return nil
+}
+
+type whitespaceStage struct {
+	c       *cmdCtx
+	fields  []string
+	trimCnt int
+}
+
+func newWhitespaceStage(c *cmdCtx, o options) *whitespaceStage {
+	return &whitespaceStage{
+		c:      c,
+		fields: o.StringSlice("fields"),
+	}
+}
+
+func (s *whitespaceStage) apply(line int, d datum) (string, error) {
+	for _, field := range s.fields {
+		str, ok := d[field].(string)
+		if !ok {
+			continue
+		}
+		strTrm := strings.TrimSpace(str)
+		if str != strTrm {
+			s.trimCnt++
+			s.c.logger.Debug().
+				Int("line", line).
+				Str("field", field).
+				Str("before", str).
+				Str("after", strTrm).
+				Msg("trimmed whitespace")
+		}
+		d[field] = strTrm
+	}
+	return "", nil
 }
@@ -36,7 +36,10 @@ func TestCmdWhitespace(t *testing.T) {
 		set.Var(cli.NewStringSlice("nonexistent"), "fields", "doc")
 		ctx.c = cli.NewContext(app, set, nil)
 
-		err := cmdWhitespace(ctx)
+		err := write(inputPath, ctx.data)
+		require.NoError(t, err, "Unexpected error writing input file")
+
+		err = cmdWhitespace(ctx)
 		assert.NoError(t, err, "Unexpected error in cmdWhitespace")
 
 		file, _ := os.Open(outputPath)
@@ -73,7 +76,10 @@ func TestCmdWhitespace(t *testing.T) {
 		set.Var(cli.NewStringSlice("test"), "fields", "doc")
 		ctx.c = cli.NewContext(app, set, nil)
 
-		err := cmdWhitespace(ctx)
+		err := write(inputPath, ctx.data)
+		require.NoError(t, err, "Unexpected error writing input file")
+
+		err = cmdWhitespace(ctx)
 		assert.NoError(t, err, "Unexpected error in cmdWhitespace")
 
 		file, _ := os.Open(outputPath)
@@ -110,7 +116,10 @@ func TestCmdWhitespace(t *testing.T) {
 		set.Var(cli.NewStringSlice("test"), "fields", "doc")
 		ctx.c = cli.NewContext(app, set, nil)
 
-		err := cmdWhitespace(ctx)
+		err := write(inputPath, ctx.data)
+		require.NoError(t, err, "Unexpected error writing input file")
+
+		err = cmdWhitespace(ctx)
 		assert.NoError(t, err, "Unexpected error in cmdWhitespace")
 
 		file, _ := os.Open(outputPath)
@@ -125,7 +134,7 @@ func TestCmdWhitespace(t *testing.T) {
 			data = append(data, d)
 		}
 
-		assert.Equal(t, ctx.data, data, "Unexpected data in output file")
+		assert.Equal(t, []datum{{"test": "test"}}, data, "Unexpected data in output file")
 	})
 
 	t.Run("Test with whitespace trimming", func(t *testing.T) {
@@ -147,7 +156,10 @@ func TestCmdWhitespace(t *testing.T) {
 		set.Var(cli.NewStringSlice("test"), "fields", "doc")
 		ctx.c = cli.NewContext(app, set, nil)
 
-		err := cmdWhitespace(ctx)
+		err := write(inputPath, ctx.data)
+		require.NoError(t, err, "Unexpected error writing input file")
+
+		err = cmdWhitespace(ctx)
 		assert.NoError(t, err, "Unexpected error in cmdWhitespace")
 
 		file, _ := os.Open(outputPath)
@@ -1,105 +1,255 @@
-// You don't want to use this. It's good enough, but it's not good.
+// Package limiter limits the requests and tokens per minute sent to a model.
 package limiter
 
 import (
+	"context"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 )
 
-var (
-	nilStruct struct{}
-)
+// statsInterval is how often stats are logged, and how often a starved
+// limiter is reported.
+const statsInterval = time.Minute
 
-type Limiter struct {
-	rpm            int
-	tpm            int
-	rpmC           chan struct{}
-	tpmC           chan struct{}
-	logger         *zerolog.Logger
-	statMutex      sync.Mutex
-	statRequestEst int
-	statTokenUsage int
+// clock is the time source of a Limiter, so tests can control it.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
 }
 
-func New(rpm, tpm int, logger *zerolog.Logger) *Limiter {
-	ret := &Limiter{
-		rpm:    rpm,
-		tpm:    tpm,
-		rpmC:   make(chan struct{}, rpm),
-		tpmC:   make(chan struct{}, tpm),
-		logger: logger,
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// bucket is a token bucket that refills at rate per minute, up to rate.  Its
+// level may go below zero, when callers have reserved more than it holds.
+type bucket struct {
+	rate  float64
+	level float64
+	last  time.Time
+}
+
+func newBucket(rate int, now time.Time) bucket {
+	return bucket{rate: float64(rate), level: float64(rate), last: now}
+}
+
+// unlimited reports whether the bucket has no rate, and so never waits.
+func (b *bucket) unlimited() bool {
+	return b.rate <= 0
+}
+
+func (b *bucket) refill(now time.Time) {
+	if b.unlimited() {
+		return
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.level += b.rate * elapsed.Minutes()
+		if b.level > b.rate {
+			b.level = b.rate
+		}
 	}
+	b.last = now
+}
+
+// take removes n, and returns how long until the level is back to zero.
+func (b *bucket) take(n float64) time.Duration {
+	if b.unlimited() {
+		return 0
+	}
+	b.level -= n
+	if b.level >= 0 {
+		return 0
+	}
+	return time.Duration(-b.level / b.rate * float64(time.Minute))
+}
 
-	if logger != nil {
-		go ret.stats()
+// give returns n, up to the bucket's capacity.
+func (b *bucket) give(n float64) {
+	b.level += n
+	if b.level > b.rate {
+		b.level = b.rate
 	}
+}
 
-	ret.start()
-	return ret
+// lower lowers the rate to limit, and the level to remaining, if they're
+// lower.  Negative values are ignored.
+func (b *bucket) lower(limit, remaining int) {
+	if limit > 0 && b.unlimited() {
+		b.rate = float64(limit)
+		b.level = b.rate
+	} else if limit > 0 && float64(limit) < b.rate {
+		b.rate = float64(limit)
+		if b.level > b.rate {
+			b.level = b.rate
+		}
+	}
+	if remaining >= 0 && !b.unlimited() && float64(remaining) < b.level {
+		b.level = float64(remaining)
+	}
 }
 
-func (l *Limiter) start() {
-	go filler(l.rpm, l.rpmC)
-	go filler(l.tpm, l.tpmC)
+// Stats are the totals of a Limiter since it was created.
+type Stats struct {
+	Requests  int
+	EstTokens int
+	Tokens    int
+	// Waits is the number of requests that had to wait, for Waited in total.
+	Waits  int
+	Waited time.Duration
 }
 
-func (l *Limiter) stats() {
-	for range time.Tick(1 * time.Minute) {
-		l.statMutex.Lock()
-		l.logger.Debug().
-			Int("rpm_chan_len", len(l.rpmC)).
-			Int("tpm_chan_len", len(l.tpmC)).
-			Int("request_est_1m", l.statRequestEst).
-			Int("token_usage_1m", l.statTokenUsage).
-			Msg("limiter stats")
-		l.statRequestEst = 0
-		l.statTokenUsage = 0
-		l.statMutex.Unlock()
+// Limiter is a pair of token buckets, for requests and tokens per minute.
+// Both start full, so a minute's worth can be sent in a burst, and refill
+// continuously.  Each call does a constant amount of work.
+//
+// Wait reserves a request and an estimate of its tokens, and waits until
+// both buckets have caught up, so callers are served in order.  Once the
+// response arrives, TPMReconcile swaps the estimate for the tokens actually
+// used.
+type Limiter struct {
+	mu       sync.Mutex
+	clock    clock
+	logger   *zerolog.Logger
+	requests bucket
+	tokens   bucket
+
+	stats Stats
+	// interval holds the stats since lastReport.
+	interval   Stats
+	lastReport time.Time
+}
+
+// New returns a limiter for rpm requests and tpm tokens per minute.  Limits
+// of 0 or less are unlimited.  If logger is set, stats are logged every
+// minute, and a warning is logged when requests had to wait.
+func New(rpm, tpm int, logger *zerolog.Logger) *Limiter {
+	return newLimiter(rpm, tpm, logger, realClock{})
+}
+
+func newLimiter(rpm, tpm int, logger *zerolog.Logger, c clock) *Limiter {
+	now := c.Now()
+	return &Limiter{
+		clock:      c,
+		logger:     logger,
+		requests:   newBucket(rpm, now),
+		tokens:     newBucket(tpm, now),
+		lastReport: now,
 	}
 }
 
-func (l *Limiter) Wait(est int) {
-	for i := 0; i < est; i++ {
-		<-l.tpmC
+// Wait blocks until a request estimated to use est tokens can be sent.  If
+// ctx is canceled first, the reservation is returned and ctx's error is
+// returned.
+func (l *Limiter) Wait(ctx context.Context, est int) error {
+	d := l.reserve(est)
+	if d <= 0 {
+		return nil
 	}
-	<-l.rpmC
 
-	if l.logger != nil {
-		l.statMutex.Lock()
-		l.statRequestEst += est
-		l.statMutex.Unlock()
+	select {
+	case <-l.clock.After(d):
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.requests.give(1)
+		l.tokens.give(float64(est))
+		l.mu.Unlock()
+		return ctx.Err()
 	}
 }
 
-func (l *Limiter) TPMReconcile(est, tokens int) {
-	// Take out the actual token count.
-	for i := 0; i < tokens; i++ {
-		<-l.tpmC
-	}
+// reserve takes a request and est tokens, and returns how long the caller
+// must wait before sending it.
+func (l *Limiter) reserve(est int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	if l.logger != nil {
-		l.statMutex.Lock()
-		l.statTokenUsage += tokens
-		l.statMutex.Unlock()
+	now := l.clock.Now()
+	l.requests.refill(now)
+	l.tokens.refill(now)
+
+	d := l.requests.take(1)
+	if td := l.tokens.take(float64(est)); td > d {
+		d = td
 	}
 
-	// Return the byte count.
-	for i := 0; i < est; i++ {
-		select {
-		case l.tpmC <- nilStruct:
-		default:
+	for _, s := range []*Stats{&l.stats, &l.interval} {
+		s.Requests++
+		s.EstTokens += est
+		if d > 0 {
+			s.Waits++
+			s.Waited += d
 		}
 	}
+	l.report(now)
+
+	return d
 }
 
-func filler(fpm int, c chan<- struct{}) {
-	ticker := time.NewTicker(time.Minute / time.Duration(fpm))
-	for range ticker.C {
-		select {
-		case c <- nilStruct:
-		default:
-		}
+// TPMReconcile replaces the estimate of a request's tokens with the tokens it
+// actually used.
+func (l *Limiter) TPMReconcile(est, tokens int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens.refill(l.clock.Now())
+	l.tokens.give(float64(est - tokens))
+
+	l.stats.Tokens += tokens
+	l.interval.Tokens += tokens
+}
+
+// Sync adjusts the limiter to the rate limit state a server reported, such
+// as in x-ratelimit-* headers.  Arguments below 0 weren't reported.  The
+// server's limits can only lower the limiter's rates, and its remaining
+// counts can only lower the buckets, since responses can arrive out of
+// order.
+func (l *Limiter) Sync(limitRequests, limitTokens, remainingRequests, remainingTokens int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	l.requests.refill(now)
+	l.tokens.refill(now)
+
+	l.requests.lower(limitRequests, remainingRequests)
+	l.tokens.lower(limitTokens, remainingTokens)
+}
+
+// Stats returns the limiter's totals.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// report logs the stats since the last report, if statsInterval has passed.
+// It must be called with l.mu held.
+func (l *Limiter) report(now time.Time) {
+	if l.logger == nil || now.Sub(l.lastReport) < statsInterval {
+		return
+	}
+
+	s := l.interval
+	l.logger.Debug().
+		Int("requests", s.Requests).
+		Int("request_est", s.EstTokens).
+		Int("token_usage", s.Tokens).
+		Float64("rpm_level", l.requests.level).
+		Float64("tpm_level", l.tokens.level).
+		Msg("limiter stats")
+
+	if s.Waits > 0 {
+		l.logger.Warn().
+			Int("waits", s.Waits).
+			Int("requests", s.Requests).
+			Str("waited", s.Waited.Round(time.Millisecond).String()).
+			Msg("rate limited, requests are waiting for --rpm or --tpm")
 	}
+
+	l.interval = Stats{}
+	l.lastReport = now
 }
@@ -0,0 +1,218 @@
+package limiter
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock only moves when advanced.  Timers from After fire once the clock
+// reaches their deadline.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []fakeTimer
+	waiting chan struct{}
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		waiting: make(chan struct{}, 100),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), c: ch})
+	c.waiting <- struct{}{}
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	var pending []fakeTimer
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = pending
+}
+
+func TestBurst(t *testing.T) {
+	clk := newFakeClock()
+	l := newLimiter(60, 0, nil, clk)
+
+	// A full minute's worth can be sent at once.
+	for i := 0; i < 60; i++ {
+		assert.Equal(t, time.Duration(0), l.reserve(1000000))
+	}
+
+	// Then one request a second.
+	assert.Equal(t, time.Second, l.reserve(0))
+	assert.Equal(t, 2*time.Second, l.reserve(0))
+
+	clk.Advance(2 * time.Second)
+	assert.Equal(t, time.Second, l.reserve(0))
+}
+
+func TestTokens(t *testing.T) {
+	clk := newFakeClock()
+	l := newLimiter(0, 600, nil, clk)
+
+	assert.Equal(t, time.Duration(0), l.reserve(500))
+	assert.Equal(t, 10*time.Second, l.reserve(200))
+
+	// The actual usage was lower than the estimates, so the debt is repaid.
+	l.TPMReconcile(500, 100)
+	assert.Equal(t, time.Duration(0), l.reserve(0))
+
+	// Requests over the limit wait for the excess to refill, rather than
+	// forever.
+	clk.Advance(time.Minute)
+	assert.Equal(t, 30*time.Second, l.reserve(900))
+}
+
+func TestReconcileCapped(t *testing.T) {
+	clk := newFakeClock()
+	l := newLimiter(0, 600, nil, clk)
+
+	// Overestimates don't raise the bucket over its limit.
+	l.TPMReconcile(1000, 0)
+	assert.Equal(t, time.Duration(0), l.reserve(600))
+	assert.Equal(t, time.Second, l.reserve(10))
+}
+
+func TestWait(t *testing.T) {
+	clk := newFakeClock()
+	l := newLimiter(1, 0, nil, clk)
+
+	require.NoError(t, l.Wait(context.Background(), 0))
+
+	done := make(chan error)
+	go func() {
+		done <- l.Wait(context.Background(), 0)
+	}()
+
+	<-clk.waiting
+	select {
+	case <-done:
+		t.Fatal("Wait returned before the bucket refilled")
+	default:
+	}
+
+	clk.Advance(time.Minute)
+	require.NoError(t, <-done)
+}
+
+func TestWaitCanceled(t *testing.T) {
+	clk := newFakeClock()
+	l := newLimiter(1, 60, nil, clk)
+
+	require.NoError(t, l.Wait(context.Background(), 60))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- l.Wait(ctx, 60)
+	}()
+
+	<-clk.waiting
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// The canceled reservation was returned, so the next request only waits
+	// for the first to refill.
+	assert.Equal(t, time.Minute, l.reserve(60))
+}
+
+func TestUnlimited(t *testing.T) {
+	l := newLimiter(0, -1, nil, newFakeClock())
+
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, time.Duration(0), l.reserve(1000000))
+	}
+}
+
+func TestSync(t *testing.T) {
+	clk := newFakeClock()
+	l := newLimiter(600, 100000, nil, clk)
+
+	// The server says only 1 request is left, and limits us to 60 a minute.
+	l.Sync(60, -1, 1, -1)
+	assert.Equal(t, time.Duration(0), l.reserve(0))
+	assert.Equal(t, time.Second, l.reserve(0))
+
+	// Higher limits and remaining counts are ignored.
+	l.Sync(6000, 1000000, 6000, 1000000)
+	assert.Equal(t, 2*time.Second, l.reserve(0))
+
+	// Tokens too.
+	l = newLimiter(0, 100000, nil, clk)
+	l.Sync(-1, -1, -1, 0)
+	assert.Equal(t, 60*time.Millisecond, l.reserve(100))
+
+	// A server can limit a limiter that had no limit.
+	l = newLimiter(0, 0, nil, clk)
+	l.Sync(60, -1, 0, -1)
+	assert.Equal(t, time.Second, l.reserve(0))
+}
+
+func TestStats(t *testing.T) {
+	clk := newFakeClock()
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	l := newLimiter(1, 0, &logger, clk)
+
+	l.reserve(10)
+	l.reserve(20)
+	l.TPMReconcile(10, 15)
+
+	assert.Equal(t, Stats{
+		Requests:  2,
+		EstTokens: 30,
+		Tokens:    15,
+		Waits:     1,
+		Waited:    time.Minute,
+	}, l.Stats())
+	assert.Empty(t, buf.String())
+
+	// Starvation is reported once a minute.
+	clk.Advance(statsInterval)
+	l.reserve(0)
+	assert.Contains(t, buf.String(), `"waits":2`)
+	assert.Contains(t, buf.String(), "rate limited")
+
+	buf.Reset()
+	clk.Advance(statsInterval)
+	l.reserve(0)
+	assert.Contains(t, buf.String(), "limiter stats")
+	assert.Contains(t, buf.String(), "rate limited")
+}
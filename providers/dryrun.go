@@ -1,13 +1,23 @@
 package providers
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"strings"
+)
 
 type DryRun struct{}
 
-func (d *DryRun) Infer(req *InferRequest) (*InferResponse, error) {
+func (d *DryRun) Infer(ctx context.Context, req *InferRequest) (*InferResponse, error) {
+	var messages strings.Builder
+	for _, m := range req.Messages {
+		fmt.Fprintf(&messages, "%s: %s\n", m.Role, m.Content)
+	}
+
 	fmt.Printf(
-		"--BEGIN\nSystem Prompt: %s\nPrompt: %s\n--END\n",
+		"--BEGIN\nSystem Prompt: %s\n%sPrompt: %s\n--END\n",
 		req.SystemPrompt,
+		messages.String(),
 		req.Prompt,
 	)
 
@@ -18,7 +28,7 @@ func (d *DryRun) Infer(req *InferRequest) (*InferResponse, error) {
 	}, nil
 }
 
-func (d *DryRun) Ping() error {
+func (d *DryRun) Ping(ctx context.Context) error {
 	return nil
 }
 
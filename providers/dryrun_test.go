@@ -1,6 +1,7 @@
 package providers
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -22,7 +23,7 @@ func TestInfer(t *testing.T) {
 		Tokens: len(req.Prompt) * 2,
 	}
 
-	resp, err := d.Infer(req)
+	resp, err := d.Infer(context.Background(), req)
 
 	assert.Nil(t, err)
 	assert.Equal(t, expectedResponse, resp)
@@ -40,7 +41,7 @@ func TestInfer(t *testing.T) {
 		Tokens: len(req.Prompt) * 2,
 	}
 
-	resp, err = d.Infer(req)
+	resp, err = d.Infer(context.Background(), req)
 
 	assert.Nil(t, err)
 	assert.Equal(t, expectedResponse, resp)
@@ -50,7 +51,7 @@ func TestPing(t *testing.T) {
 	d := NewDryRun()
 
 	// Since Ping() just returns nil, we only need to check if it returns error as nil.
-	err := d.Ping()
+	err := d.Ping(context.Background())
 
 	assert.Nil(t, err)
 }
@@ -0,0 +1,192 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError is a non-2xx response from a provider's HTTP API.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// RetryAfter is how long the server asked us to wait before retrying, or
+	// 0 if it didn't say.
+	RetryAfter time.Duration
+	// RateLimit is the rate limit state reported with the response, if any.
+	RateLimit *RateLimit
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    errorMessage(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		RateLimit:  parseRateLimit(resp.Header),
+	}
+}
+
+// Retryable reports whether a request that failed with err may succeed if
+// it's sent again.  Rate limits, server errors, timeouts and network errors
+// are retryable.  Other API errors, such as a bad token, a prompt that's too
+// long or a refusal, aren't.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusRequestTimeout ||
+			apiErr.StatusCode == http.StatusTooManyRequests ||
+			apiErr.StatusCode >= 500
+	}
+
+	return true
+}
+
+// RetryAfter returns how long the server asked us to wait before retrying
+// the request that failed with err, or 0 if it didn't say.
+func RetryAfter(err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RetryAfter
+	}
+	return 0
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(strings.TrimSpace(h)); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(h); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// apiErrorTransport returns non-2xx responses as an *APIError, for clients
+// that don't use doJSON, such as the openai client, which otherwise drops the
+// Retry-After header.
+type apiErrorTransport struct {
+	base http.RoundTripper
+}
+
+func (t apiErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || (resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+		return resp, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, newAPIError(resp, b)
+}
+
+// errorBody matches the error responses of the Messages API, Ollama and
+// llama.cpp, where "error" is either a string or an object.
+type errorBody struct {
+	Error json.RawMessage `json:"error"`
+}
+
+type errorObject struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// doJSON sends body as JSON, if set, and decodes the response into out, if
+// set.  If out is a headerSetter, it's also given the response headers.
+// Non-2xx responses are returned as an *APIError.  The request is aborted if
+// ctx is canceled.
+func doJSON(ctx context.Context, c *http.Client, method, url string, header http.Header, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newAPIError(resp, b)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if hs, ok := out.(headerSetter); ok {
+		hs.setHeader(resp.Header)
+	}
+	return json.Unmarshal(b, out)
+}
+
+func errorMessage(b []byte) string {
+	var e errorBody
+	if json.Unmarshal(b, &e) == nil && len(e.Error) > 0 {
+		var s string
+		if json.Unmarshal(e.Error, &s) == nil && s != "" {
+			return s
+		}
+
+		var o errorObject
+		if json.Unmarshal(e.Error, &o) == nil && o.Message != "" {
+			if o.Type != "" {
+				return o.Type + ": " + o.Message
+			}
+			return o.Message
+		}
+	}
+
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,114 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const llamaCppBaseURL = "http://localhost:8080"
+
+// LlamaCpp is a provider for the llama.cpp server's /completion endpoint.
+// The server only hosts a single model, so the model name is only used for
+// logging.  /completion takes a raw prompt, so any system prompt and earlier
+// messages are placed before the prompt, with each message on its own line
+// after its role.
+type LlamaCpp struct {
+	c         *http.Client
+	baseURL   string
+	model     string
+	logger    zerolog.Logger
+	maxtokens int
+}
+
+type LlamaCppConfig struct {
+	BaseURL   string
+	Timeout   time.Duration
+	Model     string
+	Logger    zerolog.Logger
+	MaxTokens int
+}
+
+func NewLlamaCpp(c LlamaCppConfig) *LlamaCpp {
+	baseURL := llamaCppBaseURL
+	if c.BaseURL != "" {
+		baseURL = c.BaseURL
+	}
+
+	return &LlamaCpp{
+		c:         &http.Client{Timeout: c.Timeout},
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		model:     c.Model,
+		logger:    c.Logger,
+		maxtokens: c.MaxTokens,
+	}
+}
+
+type llamaCppRequest struct {
+	Prompt      string   `json:"prompt"`
+	NPredict    int      `json:"n_predict,omitempty"`
+	Stream      bool     `json:"stream"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+}
+
+type llamaCppResponse struct {
+	Content         string `json:"content"`
+	TokensEvaluated int    `json:"tokens_evaluated"`
+	TokensPredicted int    `json:"tokens_predicted"`
+}
+
+func (l *LlamaCpp) Infer(ctx context.Context, req *InferRequest) (*InferResponse, error) {
+	var b strings.Builder
+	if req.SystemPrompt != "" {
+		b.WriteString(req.SystemPrompt + "\n\n")
+	}
+	for _, m := range req.Messages {
+		fmt.Fprintf(&b, "%s:\n%s\n\n", m.Role, m.Content)
+	}
+	b.WriteString(req.Prompt)
+	prompt := b.String()
+
+	body := llamaCppRequest{
+		Prompt:      prompt,
+		NPredict:    l.maxtokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stop:        req.Stop,
+		Seed:        req.Seed,
+	}
+
+	var resp llamaCppResponse
+	err := doJSON(ctx, l.c, http.MethodPost, l.baseURL+"/completion", nil, body, &resp)
+	l.logger.Debug().
+		Interface("resp", resp).
+		Err(err).
+		Msg("response from llama.cpp")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &InferResponse{
+		ID:               req.ID,
+		Resp:             resp.Content,
+		Tokens:           resp.TokensEvaluated + resp.TokensPredicted,
+		PromptTokens:     resp.TokensEvaluated,
+		CompletionTokens: resp.TokensPredicted,
+	}, nil
+}
+
+// Ping checks the server's /health endpoint, which fails while the model is
+// still loading.
+func (l *LlamaCpp) Ping(ctx context.Context) error {
+	l.logger.Debug().Str("model", l.model).Msg("pinging llama.cpp")
+	err := doJSON(ctx, l.c, http.MethodGet, l.baseURL+"/health", nil, nil, nil)
+	l.logger.Debug().Err(err).Msg("pinged llama.cpp")
+	return err
+}
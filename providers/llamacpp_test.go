@@ -0,0 +1,103 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLlamaCppInfer(t *testing.T) {
+	var got llamaCppRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/completion", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+
+		w.Write([]byte(`{"content": " no", "stop": true, "tokens_evaluated": 9, "tokens_predicted": 1}`))
+	}))
+	defer srv.Close()
+
+	l := NewLlamaCpp(LlamaCppConfig{
+		BaseURL:   srv.URL,
+		Model:     "anything",
+		Logger:    zerolog.Nop(),
+		MaxTokens: 5,
+	})
+
+	resp, err := l.Infer(context.Background(), &InferRequest{ID: 1, SystemPrompt: "sys", Prompt: "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, &InferResponse{ID: 1, Resp: " no", Tokens: 10, PromptTokens: 9, CompletionTokens: 1}, resp)
+
+	assert.Equal(t, llamaCppRequest{Prompt: "sys\n\nhello", NPredict: 5}, got)
+}
+
+func TestLlamaCppPing(t *testing.T) {
+	loading := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/health", r.URL.Path)
+		if loading {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error": {"code": 503, "message": "Loading model", "type": "unavailable_error"}}`))
+			return
+		}
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer srv.Close()
+
+	l := NewLlamaCpp(LlamaCppConfig{BaseURL: srv.URL})
+	assert.EqualError(t, l.Ping(context.Background()), "status 503: unavailable_error: Loading model")
+
+	loading = false
+	assert.NoError(t, l.Ping(context.Background()))
+}
+
+func TestLlamaCppSampling(t *testing.T) {
+	var got llamaCppRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.Write([]byte(`{"content": "yes"}`))
+	}))
+	defer srv.Close()
+
+	l := NewLlamaCpp(LlamaCppConfig{BaseURL: srv.URL, Logger: zerolog.Nop()})
+
+	temp, seed := 0.0, 42
+	_, err := l.Infer(context.Background(), &InferRequest{
+		Prompt:   "hello",
+		Sampling: Sampling{Temperature: &temp, Stop: []string{"\n"}, Seed: &seed},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, &temp, got.Temperature)
+	assert.Nil(t, got.TopP)
+	assert.Equal(t, []string{"\n"}, got.Stop)
+	assert.Equal(t, &seed, got.Seed)
+}
+
+func TestLlamaCppMessages(t *testing.T) {
+	var got llamaCppRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.Write([]byte(`{"content": "yes"}`))
+	}))
+	defer srv.Close()
+
+	l := NewLlamaCpp(LlamaCppConfig{BaseURL: srv.URL, Logger: zerolog.Nop()})
+
+	_, err := l.Infer(context.Background(), &InferRequest{
+		SystemPrompt: "sys",
+		Messages: []Message{
+			{Role: RoleUser, Content: "example"},
+			{Role: RoleAssistant, Content: "no"},
+		},
+		Prompt: "hello",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "sys\n\nuser:\nexample\n\nassistant:\nno\n\nhello", got.Prompt)
+}
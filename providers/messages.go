@@ -0,0 +1,149 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	messagesBaseURL = "https://api.anthropic.com"
+	messagesVersion = "2023-06-01"
+
+	// The Messages API requires max_tokens, so this is used when it's 0.
+	messagesDefaultMaxTokens = 4096
+)
+
+// Messages is a provider for the Anthropic-style Messages API.  The API has no
+// seed, so it's ignored.
+type Messages struct {
+	c         *http.Client
+	baseURL   string
+	model     string
+	token     string
+	logger    zerolog.Logger
+	maxtokens int
+}
+
+type MessagesConfig struct {
+	Token     string
+	BaseURL   string
+	Timeout   time.Duration
+	Model     string
+	Logger    zerolog.Logger
+	MaxTokens int
+}
+
+func NewMessages(c MessagesConfig) *Messages {
+	baseURL := messagesBaseURL
+	if c.BaseURL != "" {
+		baseURL = c.BaseURL
+	}
+
+	maxtokens := c.MaxTokens
+	if maxtokens == 0 {
+		maxtokens = messagesDefaultMaxTokens
+	}
+
+	return &Messages{
+		c:         &http.Client{Timeout: c.Timeout},
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		model:     c.Model,
+		token:     c.Token,
+		logger:    c.Logger,
+		maxtokens: maxtokens,
+	}
+}
+
+type messagesMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type messagesRequest struct {
+	Model         string            `json:"model"`
+	MaxTokens     int               `json:"max_tokens"`
+	System        string            `json:"system,omitempty"`
+	Messages      []messagesMessage `json:"messages"`
+	Temperature   *float64          `json:"temperature,omitempty"`
+	TopP          *float64          `json:"top_p,omitempty"`
+	StopSequences []string          `json:"stop_sequences,omitempty"`
+}
+
+type messagesResponse struct {
+	rateLimitHeader
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+func (m *Messages) Infer(ctx context.Context, req *InferRequest) (*InferResponse, error) {
+	body := messagesRequest{
+		Model:         m.model,
+		MaxTokens:     m.maxtokens,
+		System:        req.SystemPrompt,
+		Messages:      messagesMessages(req),
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
+	}
+
+	var resp messagesResponse
+	err := m.do(ctx, http.MethodPost, "/v1/messages", body, &resp)
+	m.logger.Debug().
+		Interface("resp", resp).
+		Err(err).
+		Msg("response from messages api")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+	for _, c := range resp.Content {
+		if c.Type == "text" {
+			text.WriteString(c.Text)
+		}
+	}
+
+	return &InferResponse{
+		ID:               req.ID,
+		Resp:             text.String(),
+		Tokens:           resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		PromptTokens:     resp.Usage.InputTokens,
+		CompletionTokens: resp.Usage.OutputTokens,
+		RateLimit:        resp.rateLimit,
+	}, nil
+}
+
+func messagesMessages(req *InferRequest) []messagesMessage {
+	var ret []messagesMessage
+	for _, m := range req.Messages {
+		ret = append(ret, messagesMessage{Role: m.Role, Content: m.Content})
+	}
+	return append(ret, messagesMessage{Role: RoleUser, Content: req.Prompt})
+}
+
+func (m *Messages) Ping(ctx context.Context) error {
+	m.logger.Debug().Msg("pinging messages api")
+	err := m.do(ctx, http.MethodGet, "/v1/models", nil, nil)
+	m.logger.Debug().Err(err).Msg("pinged messages api")
+	return err
+}
+
+func (m *Messages) do(ctx context.Context, method, path string, body, out interface{}) error {
+	header := http.Header{}
+	header.Set("x-api-key", m.token)
+	header.Set("anthropic-version", messagesVersion)
+
+	return doJSON(ctx, m.c, method, m.baseURL+path, header, body, out)
+}
@@ -0,0 +1,111 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessagesInfer(t *testing.T) {
+	var got messagesRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test-token", r.Header.Get("x-api-key"))
+		assert.Equal(t, messagesVersion, r.Header.Get("anthropic-version"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+
+		w.Write([]byte(`{
+			"content": [{"type": "text", "text": "A"}, {"type": "text", "text": "B"}],
+			"stop_reason": "max_tokens",
+			"usage": {"input_tokens": 12, "output_tokens": 3}
+		}`))
+	}))
+	defer srv.Close()
+
+	m := NewMessages(MessagesConfig{
+		Token:     "test-token",
+		BaseURL:   srv.URL,
+		Model:     "claude-test",
+		Logger:    zerolog.Nop(),
+		MaxTokens: 5,
+	})
+
+	topP := 0.9
+	resp, err := m.Infer(context.Background(), &InferRequest{
+		ID:           7,
+		SystemPrompt: "be brief",
+		Prompt:       "hello",
+		Sampling:     Sampling{TopP: &topP, Stop: []string{"END"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, &InferResponse{ID: 7, Resp: "AB", Tokens: 15, PromptTokens: 12, CompletionTokens: 3}, resp)
+
+	assert.Equal(t, "claude-test", got.Model)
+	assert.Equal(t, 5, got.MaxTokens)
+	assert.Equal(t, "be brief", got.System)
+	assert.Equal(t, []messagesMessage{{Role: "user", Content: "hello"}}, got.Messages)
+	assert.Nil(t, got.Temperature)
+	assert.Equal(t, &topP, got.TopP)
+	assert.Equal(t, []string{"END"}, got.StopSequences)
+}
+
+func TestMessagesDefaultMaxTokens(t *testing.T) {
+	m := NewMessages(MessagesConfig{Model: "claude-test"})
+	assert.Equal(t, messagesDefaultMaxTokens, m.maxtokens)
+	assert.Equal(t, messagesBaseURL, m.baseURL)
+}
+
+func TestMessagesError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"type": "error", "error": {"type": "rate_limit_error", "message": "slow down"}}`))
+	}))
+	defer srv.Close()
+
+	m := NewMessages(MessagesConfig{BaseURL: srv.URL, Logger: zerolog.Nop()})
+
+	_, err := m.Infer(context.Background(), &InferRequest{Prompt: "hello"})
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	assert.Equal(t, "rate_limit_error: slow down", apiErr.Message)
+}
+
+func TestMessagesPing(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/models", r.URL.Path)
+		if r.Header.Get("x-api-key") != "good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer srv.Close()
+
+	assert.NoError(t, NewMessages(MessagesConfig{Token: "good", BaseURL: srv.URL}).Ping(context.Background()))
+	assert.Error(t, NewMessages(MessagesConfig{Token: "bad", BaseURL: srv.URL}).Ping(context.Background()))
+}
+
+func TestMessagesInferCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"content": []}`))
+	}))
+	defer srv.Close()
+
+	m := NewMessages(MessagesConfig{BaseURL: srv.URL, Logger: zerolog.Nop()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := m.Infer(ctx, &InferRequest{Prompt: "hello"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -2,6 +2,8 @@ package providers
 
 import (
 	"context"
+	"errors"
+	"math"
 	"net/http"
 	"time"
 
@@ -38,10 +40,9 @@ func NewOAI(c OAIConfig) *OAI {
 	if c.BaseURL != "" {
 		clientConf.BaseURL = c.BaseURL
 	}
-	if c.Timeout != 0 {
-		clientConf.HTTPClient = &http.Client{
-			Timeout: c.Timeout,
-		}
+	clientConf.HTTPClient = &http.Client{
+		Timeout:   c.Timeout,
+		Transport: apiErrorTransport{base: http.DefaultTransport},
 	}
 
 	client := openai.NewClientWithConfig(clientConf)
@@ -55,7 +56,7 @@ func NewOAI(c OAIConfig) *OAI {
 	}
 }
 
-func (o *OAI) Infer(req *InferRequest) (*InferResponse, error) {
+func (o *OAI) Infer(ctx context.Context, req *InferRequest) (*InferResponse, error) {
 	// Build messages with optional sysprompt
 	var messages []openai.ChatCompletionMessage
 	if req.SystemPrompt != "" {
@@ -65,20 +66,34 @@ func (o *OAI) Infer(req *InferRequest) (*InferResponse, error) {
 		})
 	}
 
+	for _, m := range req.Messages {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    m.Role,
+			Content: m.Content,
+		})
+	}
+
 	messages = append(messages, openai.ChatCompletionMessage{
 		Role:    openai.ChatMessageRoleUser,
 		Content: req.Prompt,
 	})
 
+	creq := openai.ChatCompletionRequest{
+		Model:     string(o.model),
+		Messages:  messages,
+		MaxTokens: o.maxtokens,
+	}
+	if req.Temperature != nil {
+		creq.Temperature = oaiFloat(*req.Temperature)
+	}
+	if req.TopP != nil {
+		creq.TopP = oaiFloat(*req.TopP)
+	}
+	creq.Stop = req.Stop
+	creq.Seed = req.Seed
+
 	// Fire off request
-	resp, err := o.c.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model:     string(o.model),
-			Messages:  messages,
-			MaxTokens: o.maxtokens,
-		},
-	)
+	resp, err := o.c.CreateChatCompletion(ctx, creq)
 	o.logger.Debug().
 		Interface("resp", resp).
 		Err(err).
@@ -87,20 +102,36 @@ func (o *OAI) Infer(req *InferRequest) (*InferResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("no choices in response")
+	}
 
 	// Parse response
 	ret := &InferResponse{
-		ID:     req.ID,
-		Resp:   resp.Choices[0].Message.Content,
-		Tokens: resp.Usage.TotalTokens,
+		ID:               req.ID,
+		Resp:             resp.Choices[0].Message.Content,
+		Tokens:           resp.Usage.TotalTokens,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		RateLimit:        parseRateLimit(resp.Header()),
 	}
 
 	return ret, nil
 }
 
-func (o *OAI) Ping() error {
+// oaiFloat converts f for a request field that the openai client omits when
+// it's 0, such as temperature and top_p, by sending the smallest float32
+// instead.
+func oaiFloat(f float64) float32 {
+	if f == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return float32(f)
+}
+
+func (o *OAI) Ping(ctx context.Context) error {
 	o.logger.Debug().Msg("pinging openai")
-	_, err := o.c.ListModels(context.Background())
+	_, err := o.c.ListModels(ctx)
 	o.logger.Debug().Err(err).Msg("pinged openai")
 	return err
 }
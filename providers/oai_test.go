@@ -1 +1,81 @@
 package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOAIInfer(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat/completions", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.Write([]byte(`{
+			"choices": [{"message": {"role": "assistant", "content": "yes"}}],
+			"usage": {"prompt_tokens": 10, "completion_tokens": 1, "total_tokens": 11}
+		}`))
+	}))
+	defer srv.Close()
+
+	o := NewOAI(OAIConfig{BaseURL: srv.URL, Model: "gpt-test", Logger: zerolog.Nop()})
+
+	temp, seed := 0.0, 7
+	resp, err := o.Infer(context.Background(), &InferRequest{
+		ID:           2,
+		SystemPrompt: "sys",
+		Messages: []Message{
+			{Role: RoleUser, Content: "example"},
+			{Role: RoleAssistant, Content: "no"},
+		},
+		Prompt:   "hello",
+		Sampling: Sampling{Temperature: &temp, Stop: []string{"\n"}, Seed: &seed},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &InferResponse{ID: 2, Resp: "yes", Tokens: 11, PromptTokens: 10, CompletionTokens: 1}, resp)
+
+	assert.Equal(t, "gpt-test", got["model"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"role": "system", "content": "sys"},
+		map[string]interface{}{"role": "user", "content": "example"},
+		map[string]interface{}{"role": "assistant", "content": "no"},
+		map[string]interface{}{"role": "user", "content": "hello"},
+	}, got["messages"])
+	assert.Contains(t, got, "temperature")
+	assert.NotContains(t, got, "top_p")
+	assert.Equal(t, []interface{}{"\n"}, got["stop"])
+	assert.Equal(t, 7.0, got["seed"])
+}
+
+func TestOAIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error": {"type": "requests", "message": "rate limit reached"}}`))
+	}))
+	defer srv.Close()
+
+	o := NewOAI(OAIConfig{BaseURL: srv.URL, Logger: zerolog.Nop()})
+
+	_, err := o.Infer(context.Background(), &InferRequest{Prompt: "hello"})
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	assert.Equal(t, "requests: rate limit reached", apiErr.Message)
+	assert.Equal(t, 3*time.Second, RetryAfter(err))
+	assert.True(t, Retryable(err))
+}
+
+func TestOAIFloat(t *testing.T) {
+	assert.Equal(t, float32(0.7), oaiFloat(0.7))
+	assert.NotZero(t, oaiFloat(0))
+}
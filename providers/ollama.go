@@ -0,0 +1,139 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const ollamaBaseURL = "http://localhost:11434"
+
+// Ollama is a provider for Ollama's /api/chat endpoint.
+type Ollama struct {
+	c         *http.Client
+	baseURL   string
+	model     string
+	logger    zerolog.Logger
+	maxtokens int
+}
+
+type OllamaConfig struct {
+	BaseURL   string
+	Timeout   time.Duration
+	Model     string
+	Logger    zerolog.Logger
+	MaxTokens int
+}
+
+func NewOllama(c OllamaConfig) *Ollama {
+	baseURL := ollamaBaseURL
+	if c.BaseURL != "" {
+		baseURL = c.BaseURL
+	}
+
+	return &Ollama{
+		c:         &http.Client{Timeout: c.Timeout},
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		model:     c.Model,
+		logger:    c.Logger,
+		maxtokens: c.MaxTokens,
+	}
+}
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaOptions struct {
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  ollamaOptions   `json:"options"`
+}
+
+type ollamaResponse struct {
+	Message         ollamaMessage `json:"message"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+type ollamaTags struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+func (o *Ollama) Infer(ctx context.Context, req *InferRequest) (*InferResponse, error) {
+	var messages []ollamaMessage
+	if req.SystemPrompt != "" {
+		messages = append(messages, ollamaMessage{Role: "system", Content: req.SystemPrompt})
+	}
+	for _, m := range req.Messages {
+		messages = append(messages, ollamaMessage{Role: m.Role, Content: m.Content})
+	}
+	messages = append(messages, ollamaMessage{Role: "user", Content: req.Prompt})
+
+	body := ollamaRequest{
+		Model:    o.model,
+		Messages: messages,
+		Options: ollamaOptions{
+			NumPredict:  o.maxtokens,
+			Temperature: req.Temperature,
+			TopP:        req.TopP,
+			Stop:        req.Stop,
+			Seed:        req.Seed,
+		},
+	}
+
+	var resp ollamaResponse
+	err := doJSON(ctx, o.c, http.MethodPost, o.baseURL+"/api/chat", nil, body, &resp)
+	o.logger.Debug().
+		Interface("resp", resp).
+		Err(err).
+		Msg("response from ollama")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &InferResponse{
+		ID:               req.ID,
+		Resp:             resp.Message.Content,
+		Tokens:           resp.PromptEvalCount + resp.EvalCount,
+		PromptTokens:     resp.PromptEvalCount,
+		CompletionTokens: resp.EvalCount,
+	}, nil
+}
+
+// Ping checks that the server is up and has pulled the model.
+func (o *Ollama) Ping(ctx context.Context) error {
+	o.logger.Debug().Msg("pinging ollama")
+
+	var tags ollamaTags
+	err := doJSON(ctx, o.c, http.MethodGet, o.baseURL+"/api/tags", nil, nil, &tags)
+	o.logger.Debug().Err(err).Msg("pinged ollama")
+	if err != nil {
+		return err
+	}
+
+	for _, m := range tags.Models {
+		if m.Name == o.model || m.Name == o.model+":latest" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("model %q not found, pull it with 'ollama pull %s'", o.model, o.model)
+}
@@ -0,0 +1,85 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOllamaInfer(t *testing.T) {
+	var got ollamaRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/chat", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+
+		w.Write([]byte(`{
+			"message": {"role": "assistant", "content": "yes"},
+			"done": true,
+			"prompt_eval_count": 20,
+			"eval_count": 2
+		}`))
+	}))
+	defer srv.Close()
+
+	o := NewOllama(OllamaConfig{
+		BaseURL:   srv.URL,
+		Model:     "llama3",
+		Logger:    zerolog.Nop(),
+		MaxTokens: 5,
+	})
+
+	temp := 0.0
+	resp, err := o.Infer(context.Background(), &InferRequest{ID: 3, SystemPrompt: "sys", Prompt: "hello", Sampling: Sampling{Temperature: &temp}})
+	require.NoError(t, err)
+	assert.Equal(t, &InferResponse{ID: 3, Resp: "yes", Tokens: 22, PromptTokens: 20, CompletionTokens: 2}, resp)
+
+	assert.Equal(t, "llama3", got.Model)
+	assert.False(t, got.Stream)
+	assert.Equal(t, 5, got.Options.NumPredict)
+	require.NotNil(t, got.Options.Temperature)
+	assert.Equal(t, 0.0, *got.Options.Temperature)
+	assert.Equal(t, []ollamaMessage{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "hello"},
+	}, got.Messages)
+}
+
+func TestOllamaPing(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/tags", r.URL.Path)
+		w.Write([]byte(`{"models": [{"name": "llama3:latest"}, {"name": "qwen2:7b"}]}`))
+	}))
+	defer srv.Close()
+
+	for model, ok := range map[string]bool{
+		"llama3":        true,
+		"llama3:latest": true,
+		"qwen2:7b":      true,
+		"qwen2":         false,
+		"mistral":       false,
+	} {
+		err := NewOllama(OllamaConfig{BaseURL: srv.URL, Model: model}).Ping(context.Background())
+		if ok {
+			assert.NoError(t, err, model)
+		} else {
+			assert.Error(t, err, model)
+		}
+	}
+}
+
+func TestOllamaError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "model 'nope' not found"}`))
+	}))
+	defer srv.Close()
+
+	_, err := NewOllama(OllamaConfig{BaseURL: srv.URL, Model: "nope"}).Infer(context.Background(), &InferRequest{Prompt: "hi"})
+	assert.EqualError(t, err, "status 404: model 'nope' not found")
+}
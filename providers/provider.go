@@ -1,22 +1,57 @@
 package providers
 
+import "context"
+
 type InferRequest struct {
 	ID           int
 	SystemPrompt string
-	Prompt       string
+	// Messages are earlier turns of the conversation, such as few-shot
+	// examples, sent before Prompt.
+	Messages []Message
+	Prompt   string
+	Sampling
+}
+
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is a single turn of a conversation.
+type Message struct {
+	Role    string
+	Content string
+}
+
+// Sampling holds the sampling parameters for a request.  Unset fields use the
+// provider's default, and providers ignore the ones they don't support.
+type Sampling struct {
+	Temperature *float64
+	TopP        *float64
+	Stop        []string
+	Seed        *int
 }
 
 func (r *InferRequest) ByteCnt() int {
-	return len(r.Prompt) + len(r.SystemPrompt)
+	cnt := len(r.Prompt) + len(r.SystemPrompt)
+	for _, m := range r.Messages {
+		cnt += len(m.Content)
+	}
+	return cnt
 }
 
 type InferResponse struct {
-	ID     int
-	Resp   string
-	Tokens int
+	ID   int
+	Resp string
+	// Tokens is the total tokens used, PromptTokens plus CompletionTokens.
+	Tokens           int
+	PromptTokens     int
+	CompletionTokens int
+	// RateLimit is the rate limit state the server reported, if any.
+	RateLimit *RateLimit
 }
 
 type Provider interface {
-	Infer(*InferRequest) (*InferResponse, error)
-	Ping() error
+	Infer(context.Context, *InferRequest) (*InferResponse, error)
+	Ping(context.Context) error
 }
@@ -0,0 +1,70 @@
+package providers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RateLimit is the rate limit state a server reported with a response, from
+// the x-ratelimit-* headers of OpenAI-compatible APIs, or the
+// anthropic-ratelimit-* headers of the Messages API.  Fields are -1 if the
+// server didn't report them.
+type RateLimit struct {
+	LimitRequests     int
+	LimitTokens       int
+	RemainingRequests int
+	RemainingTokens   int
+}
+
+// parseRateLimit returns the rate limit state in h, or nil if it has none.
+func parseRateLimit(h http.Header) *RateLimit {
+	rl := &RateLimit{
+		LimitRequests:     headerInt(h, "x-ratelimit-limit-requests", "anthropic-ratelimit-requests-limit"),
+		LimitTokens:       headerInt(h, "x-ratelimit-limit-tokens", "anthropic-ratelimit-tokens-limit"),
+		RemainingRequests: headerInt(h, "x-ratelimit-remaining-requests", "anthropic-ratelimit-requests-remaining"),
+		RemainingTokens:   headerInt(h, "x-ratelimit-remaining-tokens", "anthropic-ratelimit-tokens-remaining"),
+	}
+
+	if *rl == (RateLimit{-1, -1, -1, -1}) {
+		return nil
+	}
+	return rl
+}
+
+// headerInt returns the first of keys in h that is a non-negative integer,
+// or -1.
+func headerInt(h http.Header, keys ...string) int {
+	for _, k := range keys {
+		if n, err := strconv.Atoi(strings.TrimSpace(h.Get(k))); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return -1
+}
+
+// RateLimitOf returns the rate limit state reported with the error response
+// that caused err, or nil if there wasn't one.
+func RateLimitOf(err error) *RateLimit {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RateLimit
+	}
+	return nil
+}
+
+// headerSetter is implemented by responses that keep the rate limit state
+// reported with them.  doJSON calls setHeader with the response headers.
+type headerSetter interface {
+	setHeader(h http.Header)
+}
+
+// rateLimitHeader records the rate limit state of a response.
+type rateLimitHeader struct {
+	rateLimit *RateLimit
+}
+
+func (r *rateLimitHeader) setHeader(h http.Header) {
+	r.rateLimit = parseRateLimit(h)
+}
@@ -0,0 +1,78 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	assert.Nil(t, parseRateLimit(http.Header{}))
+
+	h := http.Header{}
+	h.Set("x-ratelimit-limit-requests", "500")
+	h.Set("x-ratelimit-remaining-requests", "499")
+	h.Set("x-ratelimit-remaining-tokens", "bogus")
+	assert.Equal(t, &RateLimit{
+		LimitRequests:     500,
+		LimitTokens:       -1,
+		RemainingRequests: 499,
+		RemainingTokens:   -1,
+	}, parseRateLimit(h))
+
+	h = http.Header{}
+	h.Set("anthropic-ratelimit-tokens-limit", "80000")
+	h.Set("anthropic-ratelimit-tokens-remaining", "0")
+	assert.Equal(t, &RateLimit{
+		LimitRequests:     -1,
+		LimitTokens:       80000,
+		RemainingRequests: -1,
+		RemainingTokens:   0,
+	}, parseRateLimit(h))
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ratelimit-remaining-requests", "9")
+		w.Header().Set("x-ratelimit-remaining-tokens", "900")
+		w.Header().Set("anthropic-ratelimit-requests-remaining", "9")
+		w.Header().Set("anthropic-ratelimit-tokens-remaining", "900")
+		if r.Header.Get("x-api-key") == "fail" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/chat/completions":
+			w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "yes"}}]}`))
+		case "/v1/messages":
+			w.Write([]byte(`{"content": [{"type": "text", "text": "yes"}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	want := &RateLimit{LimitRequests: -1, LimitTokens: -1, RemainingRequests: 9, RemainingTokens: 900}
+
+	for name, p := range map[string]Provider{
+		"openai":   NewOAI(OAIConfig{BaseURL: srv.URL, Model: "gpt-test", Logger: zerolog.Nop()}),
+		"messages": NewMessages(MessagesConfig{BaseURL: srv.URL, Model: "claude-test", Logger: zerolog.Nop()}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := p.Infer(context.Background(), &InferRequest{Prompt: "hello"})
+			require.NoError(t, err)
+			assert.Equal(t, want, resp.RateLimit)
+		})
+	}
+
+	m := NewMessages(MessagesConfig{Token: "fail", BaseURL: srv.URL, Model: "claude-test", Logger: zerolog.Nop()})
+	_, err := m.Infer(context.Background(), &InferRequest{Prompt: "hello"})
+	require.Error(t, err)
+	assert.Equal(t, want, RateLimitOf(fmt.Errorf("infer: %w", err)))
+	assert.Nil(t, RateLimitOf(fmt.Errorf("network")))
+}
@@ -0,0 +1,308 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+// Config configures a provider created from the registry.
+type Config struct {
+	Model     string
+	Token     string
+	BaseURL   string
+	Timeout   time.Duration
+	Logger    zerolog.Logger
+	MaxTokens int
+}
+
+// Constructor creates a provider for a model.
+type Constructor func(c Config) Provider
+
+// Model is a model known to the registry, with its defaults.  Zero values
+// mean there is no default.
+type Model struct {
+	Provider      string
+	Name          string
+	ContextWindow int
+	RPM           int
+	TPM           int
+	MaxTokens     int
+
+	// PromptPrice and CompletionPrice are the cost of 1,000 tokens.
+	PromptPrice     float64
+	CompletionPrice float64
+}
+
+// Priced reports whether the model has prices, so its cost can be known.
+func (m Model) Priced() bool {
+	return m.PromptPrice > 0 || m.CompletionPrice > 0
+}
+
+// Cost returns the cost of the given number of tokens.
+func (m Model) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*m.PromptPrice + float64(completionTokens)*m.CompletionPrice) / 1000
+}
+
+// String returns the model in "provider:model" form.
+func (m Model) String() string {
+	return m.Provider + ":" + m.Name
+}
+
+// Registry maps "provider:model" strings to provider constructors and model
+// defaults.
+type Registry struct {
+	providers map[string]Constructor
+	models    map[string]Model
+}
+
+// NewRegistry returns a registry with the built-in providers and models.
+func NewRegistry() *Registry {
+	r := &Registry{
+		providers: make(map[string]Constructor),
+		models:    make(map[string]Model),
+	}
+
+	r.Register("openai", func(c Config) Provider {
+		return NewOAI(OAIConfig{
+			Token:     c.Token,
+			BaseURL:   c.BaseURL,
+			Timeout:   c.Timeout,
+			Model:     OAIModel(c.Model),
+			Logger:    c.Logger,
+			MaxTokens: c.MaxTokens,
+		})
+	})
+	r.Register("messages", func(c Config) Provider {
+		return NewMessages(MessagesConfig{
+			Token:     c.Token,
+			BaseURL:   c.BaseURL,
+			Timeout:   c.Timeout,
+			Model:     c.Model,
+			Logger:    c.Logger,
+			MaxTokens: c.MaxTokens,
+		})
+	})
+	r.Register("ollama", func(c Config) Provider {
+		return NewOllama(OllamaConfig{
+			BaseURL:   c.BaseURL,
+			Timeout:   c.Timeout,
+			Model:     c.Model,
+			Logger:    c.Logger,
+			MaxTokens: c.MaxTokens,
+		})
+	})
+	r.Register("llamacpp", func(c Config) Provider {
+		return NewLlamaCpp(LlamaCppConfig{
+			BaseURL:   c.BaseURL,
+			Timeout:   c.Timeout,
+			Model:     c.Model,
+			Logger:    c.Logger,
+			MaxTokens: c.MaxTokens,
+		})
+	})
+
+	for _, m := range builtinModels {
+		r.AddModel(m)
+	}
+
+	return r
+}
+
+// builtinModels have the context windows, tier 1 rate limits and list prices
+// (per 1,000 tokens) published for them.  Labels are short, so they all
+// default to 5 max tokens.  A --models file can override any of these.
+var builtinModels = []Model{
+	{Provider: "openai", Name: "gpt-3.5-turbo", ContextWindow: 16385, RPM: 3500, TPM: 200000, MaxTokens: 5, PromptPrice: 0.0005, CompletionPrice: 0.0015},
+	{Provider: "openai", Name: "gpt-4", ContextWindow: 8192, RPM: 500, TPM: 10000, MaxTokens: 5, PromptPrice: 0.03, CompletionPrice: 0.06},
+	{Provider: "openai", Name: "gpt-4-turbo", ContextWindow: 128000, RPM: 500, TPM: 30000, MaxTokens: 5, PromptPrice: 0.01, CompletionPrice: 0.03},
+	{Provider: "openai", Name: "gpt-4o", ContextWindow: 128000, RPM: 500, TPM: 30000, MaxTokens: 5, PromptPrice: 0.0025, CompletionPrice: 0.01},
+	{Provider: "openai", Name: "gpt-4o-mini", ContextWindow: 128000, RPM: 500, TPM: 200000, MaxTokens: 5, PromptPrice: 0.00015, CompletionPrice: 0.0006},
+	{Provider: "messages", Name: "claude-3-haiku-20240307", ContextWindow: 200000, RPM: 50, TPM: 50000, MaxTokens: 5, PromptPrice: 0.00025, CompletionPrice: 0.00125},
+	{Provider: "messages", Name: "claude-3-5-haiku-latest", ContextWindow: 200000, RPM: 50, TPM: 50000, MaxTokens: 5, PromptPrice: 0.0008, CompletionPrice: 0.004},
+	{Provider: "messages", Name: "claude-3-5-sonnet-latest", ContextWindow: 200000, RPM: 50, TPM: 40000, MaxTokens: 5, PromptPrice: 0.003, CompletionPrice: 0.015},
+}
+
+// Register adds or replaces a provider.
+func (r *Registry) Register(name string, fn Constructor) {
+	r.providers[name] = fn
+}
+
+// AddModel adds or replaces the defaults for a model.
+func (r *Registry) AddModel(m Model) {
+	r.models[m.String()] = m
+}
+
+// Providers returns the registered provider names, sorted.
+func (r *Registry) Providers() []string {
+	var ret []string
+	for name := range r.providers {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Resolve looks up a model given as "provider:model".  If the part before
+// the first colon isn't a registered provider, such as in "llama3:8b", the
+// whole string is the model name and the provider is picked from it: claude
+// models use messages, and everything else openai.  Unknown models are
+// allowed, and have no defaults.
+func (r *Registry) Resolve(spec string) (Model, error) {
+	if spec == "" {
+		return Model{}, errors.New("empty model")
+	}
+
+	provider, name, found := strings.Cut(spec, ":")
+	if _, ok := r.providers[provider]; !found || !ok {
+		name = spec
+		provider = "openai"
+		if strings.HasPrefix(name, "claude-") {
+			provider = "messages"
+		}
+	}
+
+	if name == "" {
+		return Model{}, fmt.Errorf("missing model name in %q", spec)
+	}
+
+	if m, ok := r.models[provider+":"+name]; ok {
+		return m, nil
+	}
+
+	return Model{Provider: provider, Name: name}, nil
+}
+
+// New creates a provider for m.  c.Model is set from m.
+func (r *Registry) New(m Model, c Config) (Provider, error) {
+	fn, ok := r.providers[m.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q, must be one of %s", m.Provider, strings.Join(r.Providers(), ", "))
+	}
+
+	c.Model = m.Name
+	return fn(c), nil
+}
+
+// registryFile is the format of a registry config file, e.g.:
+//
+//	providers:
+//	  - name: vllm
+//	    type: openai
+//	    base_url: http://gpu-box:8000/v1
+//	models:
+//	  - name: vllm:mistral-7b-instruct
+//	    context_window: 32768
+//	    rpm: 600
+//	    tpm: 1000000
+//	    max_tokens: 16
+//	    prompt_price: 0.0005
+//	    completion_price: 0.0015
+type registryFile struct {
+	Providers []struct {
+		Name    string `json:"name" yaml:"name"`
+		Type    string `json:"type" yaml:"type"`
+		BaseURL string `json:"base_url" yaml:"base_url"`
+	} `json:"providers" yaml:"providers"`
+
+	// Models fields are pointers, so fields that aren't set keep the
+	// model's existing defaults.
+	Models []struct {
+		Name          string `json:"name" yaml:"name"`
+		ContextWindow *int   `json:"context_window" yaml:"context_window"`
+		RPM           *int   `json:"rpm" yaml:"rpm"`
+		TPM           *int   `json:"tpm" yaml:"tpm"`
+		MaxTokens     *int   `json:"max_tokens" yaml:"max_tokens"`
+
+		PromptPrice     *float64 `json:"prompt_price" yaml:"prompt_price"`
+		CompletionPrice *float64 `json:"completion_price" yaml:"completion_price"`
+	} `json:"models" yaml:"models"`
+}
+
+// LoadFile adds the providers and models in a YAML or JSON config file.
+// Providers are aliases of an existing provider type with a default base
+// URL.  Models that are already known, such as the built-in ones, only have
+// the fields set in the file replaced.
+func (r *Registry) LoadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var f registryFile
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(b, &f)
+	} else {
+		err = yaml.Unmarshal(b, &f)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, p := range f.Providers {
+		if p.Name == "" {
+			return errors.New("provider missing name")
+		}
+		base, ok := r.providers[p.Type]
+		if !ok {
+			return fmt.Errorf("provider %s: unknown type %q", p.Name, p.Type)
+		}
+
+		baseURL := p.BaseURL
+		r.Register(p.Name, func(c Config) Provider {
+			if c.BaseURL == "" {
+				c.BaseURL = baseURL
+			}
+			return base(c)
+		})
+	}
+
+	for _, fm := range f.Models {
+		m, err := r.Resolve(fm.Name)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range []struct {
+			dst *int
+			src *int
+		}{
+			{&m.ContextWindow, fm.ContextWindow},
+			{&m.RPM, fm.RPM},
+			{&m.TPM, fm.TPM},
+			{&m.MaxTokens, fm.MaxTokens},
+		} {
+			if f.src != nil {
+				*f.dst = *f.src
+			}
+		}
+
+		for _, f := range []struct {
+			dst *float64
+			src *float64
+		}{
+			{&m.PromptPrice, fm.PromptPrice},
+			{&m.CompletionPrice, fm.CompletionPrice},
+		} {
+			if f.src == nil {
+				continue
+			}
+			if *f.src < 0 {
+				return fmt.Errorf("model %s: negative price", fm.Name)
+			}
+			*f.dst = *f.src
+		}
+
+		r.AddModel(m)
+	}
+
+	return nil
+}
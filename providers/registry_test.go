@@ -0,0 +1,138 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryResolve(t *testing.T) {
+	r := NewRegistry()
+
+	tests := []struct {
+		spec     string
+		provider string
+		name     string
+	}{
+		{"gpt-4", "openai", "gpt-4"},
+		{"my-finetune", "openai", "my-finetune"},
+		{"claude-3-5-haiku-latest", "messages", "claude-3-5-haiku-latest"},
+		{"ollama:llama3", "ollama", "llama3"},
+		{"ollama:llama3:8b", "ollama", "llama3:8b"},
+		{"llama3:8b", "openai", "llama3:8b"},
+		{"llamacpp:claude-lookalike", "llamacpp", "claude-lookalike"},
+	}
+
+	for _, tt := range tests {
+		m, err := r.Resolve(tt.spec)
+		require.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.provider, m.Provider, tt.spec)
+		assert.Equal(t, tt.name, m.Name, tt.spec)
+	}
+
+	m, err := r.Resolve("openai:gpt-4")
+	require.NoError(t, err)
+	assert.Equal(t, 8192, m.ContextWindow)
+	assert.Equal(t, 10000, m.TPM)
+	assert.True(t, m.Priced())
+
+	_, err = r.Resolve("")
+	assert.Error(t, err)
+
+	_, err = r.Resolve("ollama:")
+	assert.Error(t, err)
+}
+
+func TestRegistryNew(t *testing.T) {
+	r := NewRegistry()
+
+	for _, spec := range []string{"gpt-4", "claude-3-5-haiku-latest", "ollama:llama3", "llamacpp:any"} {
+		m, err := r.Resolve(spec)
+		require.NoError(t, err)
+
+		p, err := r.New(m, Config{})
+		require.NoError(t, err, spec)
+		assert.NotNil(t, p, spec)
+	}
+
+	_, err := r.New(Model{Provider: "nope", Name: "x"}, Config{})
+	assert.Error(t, err)
+
+	var got Config
+	r.Register("fake", func(c Config) Provider {
+		got = c
+		return NewDryRun()
+	})
+	_, err = r.New(Model{Provider: "fake", Name: "x"}, Config{Token: "t"})
+	require.NoError(t, err)
+	assert.Equal(t, Config{Model: "x", Token: "t"}, got)
+}
+
+func TestRegistryLoadFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/health", r.URL.Path)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "models.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+providers:
+  - name: gpu
+    type: llamacpp
+    base_url: `+srv.URL+`
+models:
+  - name: gpu:mistral
+    context_window: 32768
+    rpm: 600
+    tpm: 1000000
+    max_tokens: 16
+    prompt_price: 0.5
+    completion_price: 1.5
+  - name: gpt-4
+    context_window: 1000
+    tpm: 0
+`), 0644))
+
+	r := NewRegistry()
+	require.NoError(t, r.LoadFile(path))
+
+	m, err := r.Resolve("gpu:mistral")
+	require.NoError(t, err)
+	assert.Equal(t, Model{
+		Provider:      "gpu",
+		Name:          "mistral",
+		ContextWindow: 32768,
+		RPM:           600,
+		TPM:           1000000,
+		MaxTokens:     16,
+
+		PromptPrice:     0.5,
+		CompletionPrice: 1.5,
+	}, m)
+	assert.True(t, m.Priced())
+	assert.InDelta(t, 0.65, m.Cost(1000, 100), 1e-9)
+
+	// Aliased providers use their base URL.
+	p, err := r.New(m, Config{})
+	require.NoError(t, err)
+	assert.NoError(t, p.Ping(context.Background()))
+
+	// Built-in models can be overridden, keeping the fields that aren't set.
+	m, err = r.Resolve("gpt-4")
+	require.NoError(t, err)
+	assert.Equal(t, 1000, m.ContextWindow)
+	assert.Equal(t, 500, m.RPM)
+	assert.Equal(t, 0, m.TPM)
+	assert.Equal(t, 0.03, m.PromptPrice)
+
+	bad := filepath.Join(t.TempDir(), "bad.json")
+	require.NoError(t, os.WriteFile(bad, []byte(`{"providers": [{"name": "x", "type": "nope"}]}`), 0644))
+	assert.Error(t, NewRegistry().LoadFile(bad))
+}
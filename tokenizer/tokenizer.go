@@ -0,0 +1,468 @@
+// Package tokenizer counts tokens with a local byte-pair encoding tokenizer,
+// loaded from a tiktoken ranks file or a HuggingFace tokenizer.json.
+//
+// Only counting is supported, not encoding to token IDs.  Special tokens,
+// normalizers and added tokens are ignored.  Pre-tokenization patterns are
+// those of the tiktoken encoding, or read from the tokenizer.json.
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Pre-tokenization patterns of the reference implementations, which
+// compilePattern translates to RE2.
+const (
+	// gpt2Pattern is used by r50k_base, p50k_base, and HuggingFace ByteLevel
+	// pre-tokenizers with use_regex set.
+	gpt2Pattern = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+
+	cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+
+	o200kPattern = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+)
+
+// tiktokenEncodings are the known tiktoken encodings.  A ranks file is
+// matched to one by its name, or failing that by its number of ranks.
+var tiktokenEncodings = []struct {
+	name    string
+	ranks   int
+	pattern string
+}{
+	{"r50k", 50256, gpt2Pattern},
+	{"p50k", 50280, gpt2Pattern},
+	{"cl100k", 100256, cl100kPattern},
+	{"o200k", 199998, o200kPattern},
+}
+
+// pattern is a pre-tokenization pattern, translated to RE2.
+type pattern struct {
+	re *regexp.Regexp
+
+	// spaceLookahead is set if the pattern had a `\s+(?!\S)` alternative,
+	// which RE2 can't express.  splitWords emulates it instead.
+	spaceLookahead bool
+}
+
+// compilePattern translates a pre-tokenization pattern to RE2.  The
+// `\s+(?!\S)` alternative is dropped for splitWords to emulate, and
+// possessive quantifiers become greedy, which matches the same text in these
+// patterns.  Any other lookaround is an error.
+func compilePattern(src string) (*pattern, error) {
+	p := &pattern{}
+
+	if strings.Contains(src, `\s+(?!\S)|`) {
+		src = strings.Replace(src, `\s+(?!\S)|`, "", 1)
+		p.spaceLookahead = true
+	}
+	for _, q := range []string{"?+", "++", "*+"} {
+		src = strings.ReplaceAll(src, q, q[:1])
+	}
+
+	re, err := regexp.Compile(`^(?:` + src + `)`)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported pre-tokenizer pattern: %w", err)
+	}
+	p.re = re
+
+	return p, nil
+}
+
+func mustCompilePattern(src string) *pattern {
+	p, err := compilePattern(src)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Tokenizer counts byte-pair encoded tokens.
+type Tokenizer struct {
+	pattern *pattern
+
+	// prefixSpace adds a space to the start of text that doesn't have one.
+	prefixSpace bool
+
+	// token reports whether a whole word is a single token, without merging.
+	// It may be nil.
+	token func(word string) bool
+
+	// rank returns the merge priority of two adjacent parts, lower merges
+	// first.
+	rank func(a, b string) (int, bool)
+
+	// split returns the initial parts of a pre-tokenized word.
+	split func(word string) []string
+}
+
+// Load loads a tokenizer from path.  Files ending in .json are read as
+// HuggingFace tokenizers, anything else as tiktoken ranks.
+func Load(path string) (*Tokenizer, error) {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return LoadHuggingFace(path)
+	}
+	return LoadTiktoken(path)
+}
+
+// LoadTiktoken loads a tiktoken ranks file, where each line is a base64
+// encoded token and its rank.  Ranks files don't include their
+// pre-tokenization pattern, so the file must be one of tiktokenEncodings:
+// either named after it, e.g. cl100k_base.tiktoken, or with the same number of
+// ranks.
+func LoadTiktoken(path string) (*Tokenizer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ranks := make(map[string]int)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		tok, rankStr, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid tiktoken line %q", line)
+		}
+
+		b, err := base64.StdEncoding.DecodeString(tok)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tiktoken token %q: %w", tok, err)
+		}
+
+		rank, err := strconv.Atoi(rankStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tiktoken rank %q: %w", rankStr, err)
+		}
+
+		ranks[string(b)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ranks) == 0 {
+		return nil, errors.New("empty tiktoken file")
+	}
+
+	src, err := tiktokenPattern(path, len(ranks))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokenizer{
+		pattern: mustCompilePattern(src),
+		token: func(word string) bool {
+			_, ok := ranks[word]
+			return ok
+		},
+		rank: func(a, b string) (int, bool) {
+			r, ok := ranks[a+b]
+			return r, ok
+		},
+		split: splitBytes,
+	}, nil
+}
+
+// tiktokenPattern returns the pattern of the encoding in the ranks file at
+// path, which has n ranks.
+func tiktokenPattern(path string, n int) (string, error) {
+	name := strings.ToLower(filepath.Base(path))
+	for _, e := range tiktokenEncodings {
+		if strings.HasPrefix(name, e.name) {
+			return e.pattern, nil
+		}
+	}
+	for _, e := range tiktokenEncodings {
+		if n == e.ranks {
+			return e.pattern, nil
+		}
+	}
+	return "", fmt.Errorf("unknown tiktoken encoding in %s, name the file after its encoding, e.g. cl100k_base.tiktoken", path)
+}
+
+type hfTokenizer struct {
+	PreTokenizer *hfPreTokenizer `json:"pre_tokenizer"`
+	Decoder      *struct {
+		Type string `json:"type"`
+	} `json:"decoder"`
+	Model struct {
+		Type                    string            `json:"type"`
+		Vocab                   map[string]int    `json:"vocab"`
+		Merges                  []json.RawMessage `json:"merges"`
+		ByteFallback            bool              `json:"byte_fallback"`
+		IgnoreMerges            bool              `json:"ignore_merges"`
+		ContinuingSubwordPrefix string            `json:"continuing_subword_prefix"`
+		EndOfWordSuffix         string            `json:"end_of_word_suffix"`
+	} `json:"model"`
+}
+
+type hfPreTokenizer struct {
+	Type string `json:"type"`
+
+	// Sequence
+	PreTokenizers []hfPreTokenizer `json:"pretokenizers"`
+
+	// ByteLevel
+	AddPrefixSpace bool  `json:"add_prefix_space"`
+	UseRegex       *bool `json:"use_regex"`
+
+	// Split
+	Pattern struct {
+		Regex string `json:"Regex"`
+	} `json:"pattern"`
+	Behavior string `json:"behavior"`
+	Invert   bool   `json:"invert"`
+}
+
+// LoadHuggingFace loads a byte-level BPE tokenizer.json, as used by GPT-2,
+// Llama 3 and many others.  The pre-tokenization pattern is read from the
+// file.  Other tokenizers, such as the SentencePiece-style BPE of Llama 2 and
+// Mistral, are an error.
+func LoadHuggingFace(path string) (*Tokenizer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var hf hfTokenizer
+	if err := json.Unmarshal(b, &hf); err != nil {
+		return nil, err
+	}
+
+	if hf.Model.Type != "BPE" {
+		return nil, fmt.Errorf("unsupported tokenizer model %q, only BPE is supported", hf.Model.Type)
+	}
+	if hf.Model.ByteFallback || hf.Decoder == nil || hf.Decoder.Type != "ByteLevel" {
+		return nil, errors.New("unsupported tokenizer, only byte-level BPE is supported, not SentencePiece-style BPE")
+	}
+	if hf.Model.ContinuingSubwordPrefix != "" || hf.Model.EndOfWordSuffix != "" {
+		return nil, errors.New("unsupported tokenizer, subword prefixes and suffixes aren't supported")
+	}
+
+	pat, prefixSpace, err := hfPattern(hf.PreTokenizer)
+	if err != nil {
+		return nil, err
+	}
+
+	merges := make(map[string]int, len(hf.Model.Merges))
+	for i, raw := range hf.Model.Merges {
+		// Merges are either "a b" strings or ["a", "b"] pairs.
+		var pair []string
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			a, b, ok := strings.Cut(s, " ")
+			if !ok {
+				return nil, fmt.Errorf("invalid merge %q", s)
+			}
+			pair = []string{a, b}
+		} else if err := json.Unmarshal(raw, &pair); err != nil || len(pair) != 2 {
+			return nil, fmt.Errorf("invalid merge %s", string(raw))
+		}
+
+		key := pair[0] + " " + pair[1]
+		if _, ok := merges[key]; !ok {
+			merges[key] = i
+		}
+	}
+
+	t := &Tokenizer{
+		pattern:     pat,
+		prefixSpace: prefixSpace,
+		rank: func(a, b string) (int, bool) {
+			r, ok := merges[a+" "+b]
+			return r, ok
+		},
+		split: splitByteLevel,
+	}
+
+	// With ignore_merges, words in the vocabulary aren't merged.
+	if hf.Model.IgnoreMerges {
+		vocab := hf.Model.Vocab
+		t.token = func(word string) bool {
+			_, ok := vocab[strings.Join(splitByteLevel(word), "")]
+			return ok
+		}
+	}
+
+	return t, nil
+}
+
+// hfPattern returns the pattern of a ByteLevel pre-tokenizer, either on its
+// own or in a Sequence after a Split, as in Llama 3.  It also returns whether
+// a space is added to the start of the text.
+func hfPattern(pt *hfPreTokenizer) (*pattern, bool, error) {
+	if pt == nil {
+		return nil, false, errors.New("unsupported tokenizer, only byte-level BPE is supported, but it has no pre_tokenizer")
+	}
+
+	steps := []hfPreTokenizer{*pt}
+	if pt.Type == "Sequence" {
+		steps = pt.PreTokenizers
+	}
+
+	var pat *pattern
+	var byteLevel, prefixSpace bool
+	for _, s := range steps {
+		switch {
+		case s.Type == "Split" && pat == nil && !byteLevel:
+			if s.Pattern.Regex == "" || s.Behavior != "Isolated" || s.Invert {
+				return nil, false, errors.New("unsupported Split pre-tokenizer, only an isolated regex split is supported")
+			}
+			p, err := compilePattern(s.Pattern.Regex)
+			if err != nil {
+				return nil, false, err
+			}
+			pat = p
+		case s.Type == "ByteLevel" && !byteLevel:
+			byteLevel = true
+			prefixSpace = s.AddPrefixSpace
+			if s.UseRegex == nil || *s.UseRegex {
+				if pat != nil {
+					return nil, false, errors.New("unsupported pre-tokenizer, a Split followed by a ByteLevel with use_regex")
+				}
+				pat = mustCompilePattern(gpt2Pattern)
+			}
+		default:
+			return nil, false, fmt.Errorf("unsupported pre-tokenizer %q, only byte-level BPE is supported", s.Type)
+		}
+	}
+
+	if !byteLevel {
+		return nil, false, errors.New("unsupported tokenizer, only byte-level BPE is supported, but the pre_tokenizer isn't ByteLevel")
+	}
+	if pat == nil {
+		return nil, false, errors.New("unsupported pre-tokenizer, it doesn't split text into words")
+	}
+
+	return pat, prefixSpace, nil
+}
+
+// Count returns the number of tokens in s.
+func (t *Tokenizer) Count(s string) int {
+	if t.prefixSpace && s != "" && !strings.HasPrefix(s, " ") {
+		s = " " + s
+	}
+
+	var n int
+	for _, word := range splitWords(t.pattern, s) {
+		n += t.countWord(word)
+	}
+	return n
+}
+
+func (t *Tokenizer) countWord(word string) int {
+	if t.token != nil && t.token(word) {
+		return 1
+	}
+
+	parts := t.split(word)
+
+	for len(parts) > 1 {
+		best := -1
+		bestRank := 0
+		for i := 0; i < len(parts)-1; i++ {
+			r, ok := t.rank(parts[i], parts[i+1])
+			if ok && (best == -1 || r < bestRank) {
+				best = i
+				bestRank = r
+			}
+		}
+
+		if best == -1 {
+			break
+		}
+
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+
+	return len(parts)
+}
+
+// splitWords pre-tokenizes s with p.  If p had a `\s+(?!\S)` alternative, a
+// run of whitespace followed by a non-space is shortened by one character, so
+// the last space joins the next word, as in the reference implementations.
+func splitWords(p *pattern, s string) []string {
+	var ret []string
+	for len(s) > 0 {
+		loc := p.re.FindStringIndex(s)
+		end := 1
+		if loc != nil && loc[1] > 0 {
+			end = loc[1]
+		}
+
+		word := s[:end]
+		if p.spaceLookahead && end < len(s) && isSpaceRun(word) {
+			next, _ := utf8.DecodeRuneInString(s[end:])
+			_, lastSize := utf8.DecodeLastRuneInString(word)
+			if !unicode.IsSpace(next) && len(word) > lastSize {
+				end -= lastSize
+				word = s[:end]
+			}
+		}
+
+		ret = append(ret, word)
+		s = s[end:]
+	}
+	return ret
+}
+
+// isSpaceRun reports whether s is only whitespace, and doesn't end in a line
+// break, which the line break alternatives match before `\s+(?!\S)`.
+func isSpaceRun(s string) bool {
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	last, _ := utf8.DecodeLastRuneInString(s)
+	return last != '\r' && last != '\n'
+}
+
+func splitBytes(word string) []string {
+	parts := make([]string, len(word))
+	for i := 0; i < len(word); i++ {
+		parts[i] = word[i : i+1]
+	}
+	return parts
+}
+
+// byteLevelChars maps each byte to the printable rune GPT-2 uses for it.
+var byteLevelChars = func() [256]string {
+	var ret [256]string
+	n := 0
+	for b := 0; b < 256; b++ {
+		if (b >= '!' && b <= '~') || (b >= 0xa1 && b <= 0xac) || (b >= 0xae && b <= 0xff) {
+			ret[b] = string(rune(b))
+			continue
+		}
+		ret[b] = string(rune(256 + n))
+		n++
+	}
+	return ret
+}()
+
+func splitByteLevel(word string) []string {
+	parts := make([]string, len(word))
+	for i := 0; i < len(word); i++ {
+		parts[i] = byteLevelChars[word[i]]
+	}
+	return parts
+}
@@ -0,0 +1,242 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTiktoken(t *testing.T, tokens ...string) string {
+	var sb strings.Builder
+	for i, tok := range tokens {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), i)
+	}
+
+	path := filepath.Join(t.TempDir(), "cl100k_base.tiktoken")
+	require.NoError(t, os.WriteFile(path, []byte(sb.String()), 0644))
+	return path
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"hello world", []string{"hello", " world"}},
+		{"hello   world", []string{"hello", "  ", " world"}},
+		{"it's 12345!", []string{"it", "'s", " ", "123", "45", "!"}},
+		{"a\n\nb", []string{"a", "\n\n", "b"}},
+		{"trailing  ", []string{"trailing", "  "}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, splitWords(mustCompilePattern(cl100kPattern), tt.in), tt.in)
+	}
+
+	gpt2 := mustCompilePattern(gpt2Pattern)
+	assert.Equal(t, []string{"it", "'s", " 12345", "!"}, splitWords(gpt2, "it's 12345!"))
+	assert.Equal(t, []string{"It", "'S"}, splitWords(mustCompilePattern(cl100kPattern), "It'S"))
+	assert.Equal(t, []string{"It", "'", "S"}, splitWords(gpt2, "It'S"))
+
+	// Without the lookahead alternative, spaces aren't given to the next word.
+	assert.Equal(t, []string{"a", "  ", "b"}, splitWords(mustCompilePattern(`\p{L}+|\s+`), "a  b"))
+}
+
+func TestCompilePattern(t *testing.T) {
+	p, err := compilePattern(`[^\r\n\p{L}\p{N}]?+\p{L}+|\s+(?!\S)|\s+`)
+	require.NoError(t, err)
+	assert.True(t, p.spaceLookahead)
+	assert.Equal(t, []string{"hi", " ", " there"}, splitWords(p, "hi  there"))
+
+	_, err = compilePattern(`(?<=a)b`)
+	assert.Error(t, err)
+}
+
+func TestTiktoken(t *testing.T) {
+	path := writeTiktoken(t, "h", "e", "l", "o", " ", "w", "r", "d", "he", "ll", "hell", "hello", " w", "or")
+
+	tk, err := Load(path)
+	require.NoError(t, err)
+
+	// "hello" merges fully, " world" becomes " w", "or", "l", "d".
+	assert.Equal(t, 1, tk.Count("hello"))
+	assert.Equal(t, 5, tk.Count("hello world"))
+	assert.Equal(t, 0, tk.Count(""))
+
+	// Bytes without a rank stay as single tokens.
+	assert.Equal(t, 3, tk.Count("xyz"))
+}
+
+// hfJSON returns a tokenizer.json with the given merges.  preTokenizer
+// defaults to a GPT-2 ByteLevel pre-tokenizer.
+func hfJSON(merges, preTokenizer string) string {
+	if preTokenizer == "" {
+		preTokenizer = `{"type": "ByteLevel", "add_prefix_space": false, "use_regex": true}`
+	}
+	return `{
+		"pre_tokenizer": ` + preTokenizer + `,
+		"decoder": {"type": "ByteLevel"},
+		"model": {"type": "BPE", "vocab": {}, "merges": ` + merges + `}
+	}`
+}
+
+func writeHF(t *testing.T, js string) string {
+	path := filepath.Join(t.TempDir(), "tokenizer.json")
+	require.NoError(t, os.WriteFile(path, []byte(js), 0644))
+	return path
+}
+
+func TestHuggingFace(t *testing.T) {
+	// "Ġ" is the byte-level character for a space.
+	for name, merges := range map[string]string{
+		"strings": `["h e", "l l", "he ll", "hell o", "Ġ w", "o r"]`,
+		"pairs":   `[["h", "e"], ["l", "l"], ["he", "ll"], ["hell", "o"], ["Ġ", "w"], ["o", "r"]]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			tk, err := Load(writeHF(t, hfJSON(merges, "")))
+			require.NoError(t, err)
+
+			assert.Equal(t, 1, tk.Count("hello"))
+			assert.Equal(t, 5, tk.Count("hello world"))
+		})
+	}
+
+	t.Run("split pattern from the file", func(t *testing.T) {
+		// As in Llama 3, numbers are split into groups of up to 3 digits.
+		pre := `{"type": "Sequence", "pretokenizers": [
+			{"type": "Split", "pattern": {"Regex": "(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\\r\\n\\p{L}\\p{N}]?\\p{L}+|\\p{N}{1,3}| ?[^\\s\\p{L}\\p{N}]+[\\r\\n]*|\\s*[\\r\\n]+|\\s+(?!\\S)|\\s+"}, "behavior": "Isolated", "invert": false},
+			{"type": "ByteLevel", "add_prefix_space": false, "use_regex": false}
+		]}`
+		// "3 4" can't merge across the "123", "45" split.
+		tk, err := Load(writeHF(t, hfJSON(`["3 4", "1 2"]`, pre)))
+		require.NoError(t, err)
+		assert.Equal(t, 4, tk.Count("12345"))
+
+		tk, err = Load(writeHF(t, hfJSON(`["3 4", "1 2"]`, "")))
+		require.NoError(t, err)
+		assert.Equal(t, 3, tk.Count("12345"))
+	})
+
+	t.Run("prefix space", func(t *testing.T) {
+		pre := `{"type": "ByteLevel", "add_prefix_space": true}`
+		tk, err := Load(writeHF(t, hfJSON(`["Ġ h", "Ġh i"]`, pre)))
+		require.NoError(t, err)
+		assert.Equal(t, 1, tk.Count("hi"))
+		assert.Equal(t, 0, tk.Count(""))
+	})
+
+	t.Run("ignore merges", func(t *testing.T) {
+		js := `{
+			"pre_tokenizer": {"type": "ByteLevel"},
+			"decoder": {"type": "ByteLevel"},
+			"model": {"type": "BPE", "ignore_merges": true, "vocab": {"abc": 0}, "merges": ["a b"]}
+		}`
+		tk, err := Load(writeHF(t, js))
+		require.NoError(t, err)
+		assert.Equal(t, 1, tk.Count("abc"))
+		assert.Equal(t, 2, tk.Count("abd"))
+	})
+
+	for name, js := range map[string]string{
+		"unsupported model": `{"model": {"type": "Unigram"}}`,
+		"sentencepiece": `{
+			"pre_tokenizer": {"type": "Metaspace", "replacement": "▁"},
+			"decoder": {"type": "Sequence"},
+			"model": {"type": "BPE", "byte_fallback": true, "merges": []}
+		}`,
+		"no pre-tokenizer": `{
+			"pre_tokenizer": null,
+			"decoder": {"type": "ByteLevel"},
+			"model": {"type": "BPE", "merges": []}
+		}`,
+		"not byte-level": hfJSON(`[]`, `{"type": "Whitespace"}`),
+		"inverted split": hfJSON(`[]`, `{"type": "Sequence", "pretokenizers": [
+			{"type": "Split", "pattern": {"Regex": "a"}, "behavior": "Isolated", "invert": true},
+			{"type": "ByteLevel", "use_regex": false}
+		]}`),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(writeHF(t, js))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestTiktokenPattern(t *testing.T) {
+	src, err := tiktokenPattern("/x/r50k_base.tiktoken", 10)
+	require.NoError(t, err)
+	assert.Equal(t, gpt2Pattern, src)
+
+	src, err = tiktokenPattern("/x/ranks", 199998)
+	require.NoError(t, err)
+	assert.Equal(t, o200kPattern, src)
+
+	_, err = tiktokenPattern("/x/ranks", 10)
+	assert.Error(t, err)
+}
+
+// TestReferenceCounts checks counts against the output of the reference
+// implementations, for real tokenizer files in $TOKENIZER_TESTDATA:
+// r50k_base.tiktoken and cl100k_base.tiktoken from tiktoken, and gpt2.json
+// and llama3.json, the tokenizer.json files of GPT-2 and Llama 3.  Missing
+// files are skipped.
+func TestReferenceCounts(t *testing.T) {
+	dir := os.Getenv("TOKENIZER_TESTDATA")
+	if dir == "" {
+		t.Skip("TOKENIZER_TESTDATA is not set")
+	}
+
+	texts := []string{
+		"tiktoken is great!",
+		"antidisestablishmentarianism",
+		"2 + 2 = 4",
+		"お誕生日おめでとう",
+	}
+	r50k := []int{6, 5, 5, 14}
+
+	for file, want := range map[string][]int{
+		"r50k_base.tiktoken":   r50k,
+		"cl100k_base.tiktoken": {6, 6, 7, 9},
+		"gpt2.json":            r50k,
+		"llama3.json":          {-1, -1, 7, -1},
+	} {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join(dir, file)
+			if _, err := os.Stat(path); err != nil {
+				t.Skip(err)
+			}
+
+			tk, err := Load(path)
+			require.NoError(t, err)
+
+			for i, text := range texts {
+				if want[i] >= 0 {
+					assert.Equal(t, want[i], tk.Count(text), text)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := Load(filepath.Join(dir, "missing.tiktoken"))
+	assert.Error(t, err)
+
+	bad := filepath.Join(dir, "bad.tiktoken")
+	require.NoError(t, os.WriteFile(bad, []byte("not-base64! 1\n"), 0644))
+	_, err = Load(bad)
+	assert.Error(t, err)
+
+	empty := filepath.Join(dir, "empty.tiktoken")
+	require.NoError(t, os.WriteFile(empty, nil, 0644))
+	_, err = Load(empty)
+	assert.Error(t, err)
+}